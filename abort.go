@@ -0,0 +1,60 @@
+package work
+
+import "fmt"
+
+// AbortCause tells why processing stopped before all items were successfully processed.
+type AbortCause int
+
+const (
+	// CauseWorker means that a worker returned an error.
+	// With WithFailureThreshold, it also means that some workers failed without exceeding the threshold.
+	CauseWorker AbortCause = iota + 1
+	// CauseThreshold means that more workers failed than tolerated by WithFailureThreshold.
+	CauseThreshold
+	// CauseFinalizer means that the finalizer returned an error.
+	CauseFinalizer
+	// CauseCanceled means that the context was cancelled or the batch shut down.
+	CauseCanceled
+	// CauseBatchFinalizer means that the function set by WithBatchFinalizer returned an error.
+	CauseBatchFinalizer
+	// CausePanic means that a worker panicked, the panic being recovered as set by WithPanicConverter.
+	CausePanic
+	// CauseValidation means that the function set by WithValidate rejected a result.
+	CauseValidation
+)
+
+func (c AbortCause) String() string {
+	switch c {
+	case CauseWorker:
+		return "worker"
+	case CauseThreshold:
+		return "failure threshold"
+	case CauseFinalizer:
+		return "finalizer"
+	case CauseCanceled:
+		return "canceled"
+	case CauseBatchFinalizer:
+		return "batch finalizer"
+	case CausePanic:
+		return "panic"
+	case CauseValidation:
+		return "validation"
+	}
+	return fmt.Sprintf("AbortCause(%d)", int(c))
+}
+
+// AbortError is returned by the calls using WithAbortCause when processing fails.
+// It records why processing stopped along with the error that caused it.
+type AbortError struct {
+	Cause AbortCause
+	Err   error
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("work: %v: %v", e.Cause, e.Err)
+}
+
+// Unwrap returns the error that caused the abort.
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,84 @@
+package work_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWithAbortCause(t *testing.T) {
+	errFail := fmt.Errorf("fail")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tc := range []struct {
+		name      string
+		ctx       context.Context
+		worker    func(context.Context, int) error
+		finalizer func(int) error
+		opts      []work.Option
+		cause     work.AbortCause
+	}{
+		{
+			name:   "worker",
+			worker: func(context.Context, int) error { return errFail },
+			cause:  work.CauseWorker,
+		},
+		{
+			name:   "threshold",
+			worker: func(context.Context, int) error { return errFail },
+			opts:   []work.Option{work.WithFailureThreshold(1)},
+			cause:  work.CauseThreshold,
+		},
+		{
+			name:      "finalizer",
+			worker:    func(context.Context, int) error { return nil },
+			finalizer: func(int) error { return errFail },
+			cause:     work.CauseFinalizer,
+		},
+		{
+			name:   "canceled",
+			ctx:    canceled,
+			worker: func(context.Context, int) error { return nil },
+			cause:  work.CauseCanceled,
+		},
+		{
+			name:   "batch finalizer",
+			worker: func(context.Context, int) error { return nil },
+			opts: []work.Option{work.WithBatchFinalizer(func(bool) error {
+				return errFail
+			}, false)},
+			cause: work.CauseBatchFinalizer,
+		},
+	} {
+		ctx := tc.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		opts := append(tc.opts, work.WithAbortCause())
+		err := work.DoNWithContext(ctx, 4, tc.worker, tc.finalizer, 1, opts...)
+		var ae *work.AbortError
+		if !errors.As(err, &ae) {
+			t.Errorf("%s: expected an AbortError, got %v", tc.name, err)
+			t.FailNow()
+		}
+		if ae.Cause != tc.cause {
+			t.Errorf("%s: unexpected cause: got %v expected %v", tc.name, ae.Cause, tc.cause)
+			t.FailNow()
+		}
+		if tc.cause != work.CauseCanceled && !errors.Is(err, errFail) {
+			t.Errorf("%s: expected the original error, got %v", tc.name, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithAbortCauseSuccess(t *testing.T) {
+	err := work.DoWithError(4, func(int) error { return nil }, nil, work.WithAbortCause())
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,154 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Action defines what happens to an item once its worker returns.
+type Action int
+
+const (
+	// Done means that the item was processed and can be finalized.
+	Done Action = iota
+	// Retry means that the item is queued again, behind the pending ones.
+	Retry
+	// Fail means that all processing must be aborted.
+	Fail
+)
+
+var (
+	// ErrFailed is returned when a worker returns Fail.
+	ErrFailed = errors.New("work: worker failed")
+	// ErrTooManyRetries is returned when the number of retries exceeds the allowed maximum.
+	ErrTooManyRetries = errors.New("work: too many retries")
+)
+
+// DoWithAction spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// The Action returned by a worker decides the fate of its item:
+// Done lets it be finalized, Retry queues it again behind the pending items and Fail aborts all processing.
+// No more than retries items can be retried in total, the next retry aborts all processing.
+// The returned error wraps ErrFailed or ErrTooManyRetries along with the index that caused the abort.
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+func DoWithAction(n int, worker func(idx int) Action, finalizer func(idx int), retries int) error {
+	return DoNWithAction(n, worker, finalizer, numRoutines, retries)
+}
+
+// DoNWithAction spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithAction.
+func DoNWithAction(n int, worker func(idx int) Action, finalizer func(idx int), max, retries int) error {
+	return doWithAction(n, worker, finalizer, max, retries, nil)
+}
+
+// DoWithActionRetries spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithAction but it also returns, for each item, the number of times it was retried,
+// the number of attempts beyond the first, e.g. to spot the inputs or dependencies causing many retries.
+func DoWithActionRetries(n int, worker func(idx int) Action, finalizer func(idx int), retries int) ([]int, error) {
+	return DoNWithActionRetries(n, worker, finalizer, numRoutines, retries)
+}
+
+// DoNWithActionRetries spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithActionRetries.
+func DoNWithActionRetries(n int, worker func(idx int) Action, finalizer func(idx int), max, retries int) ([]int, error) {
+	counts := make([]int, n)
+	err := doWithAction(n, worker, finalizer, max, retries, counts)
+	return counts, err
+}
+
+// doWithAction implements DoNWithAction, counting the retries of each item into counts if set.
+func doWithAction(n int, worker func(idx int) Action, finalizer func(idx int), max, retries int, counts []int) error {
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   = make([]int, n) // items waiting for a worker
+		running int              // number of running workers
+		retried int              // number of retries so far
+		err     error            // first error encountered
+		workc   = make(chan int) // results from workers
+		wgf     sync.WaitGroup
+	)
+	for i := range queue {
+		queue[i] = i
+	}
+
+	if finalizer != nil {
+		wgf.Add(1)
+		go func() {
+			// buffer holds results that cannot be finalized yet.
+			buffer := make(map[int]struct{})
+			pos := 0
+			for idx := range workc {
+				buffer[idx] = struct{}{}
+				for ; ; pos++ {
+					if _, ok := buffer[pos]; !ok {
+						break
+					}
+					delete(buffer, pos)
+					mu.Lock()
+					failed := err != nil
+					mu.Unlock()
+					if failed {
+						break
+					}
+					finalizer(pos)
+				}
+			}
+			wgf.Done()
+		}()
+	}
+
+	mu.Lock()
+	for {
+		// wait for an item to process, keeping in mind that running workers may requeue theirs
+		for err == nil && (running >= max || len(queue) == 0 && running > 0) {
+			cond.Wait()
+		}
+		if err != nil || len(queue) == 0 {
+			break
+		}
+		idx := queue[0]
+		queue = queue[1:]
+		running++
+		go func(idx int) {
+			a := worker(idx)
+			mu.Lock()
+			switch a {
+			case Retry:
+				if retried == retries {
+					if err == nil {
+						err = fmt.Errorf("%w at index %d", ErrTooManyRetries, idx)
+					}
+					break
+				}
+				retried++
+				if counts != nil {
+					counts[idx]++
+				}
+				queue = append(queue, idx)
+			case Fail:
+				if err == nil {
+					err = fmt.Errorf("%w at index %d", ErrFailed, idx)
+				}
+			}
+			mu.Unlock()
+			if a == Done && finalizer != nil {
+				workc <- idx
+			}
+			mu.Lock()
+			running--
+			cond.Signal()
+			mu.Unlock()
+		}(idx)
+	}
+	// wait for workers
+	for running > 0 {
+		cond.Wait()
+	}
+	mu.Unlock()
+
+	close(workc)
+	wgf.Wait()
+
+	return err
+}
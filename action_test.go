@@ -0,0 +1,120 @@
+package work_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithAction(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu       sync.Mutex
+			attempts = make([]int, n)
+		)
+		// every odd item is retried once
+		worker := func(idx int) work.Action {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[idx]++
+			if idx%2 > 0 && attempts[idx] == 1 {
+				return work.Retry
+			}
+			return work.Done
+		}
+		var final []int
+		finalizer := func(idx int) {
+			final = append(final, idx)
+		}
+		err := work.DoWithAction(n, worker, finalizer, n)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(final) != n {
+			t.Errorf("unexpected final size: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+			if expected := 1 + i%2; attempts[i] != expected {
+				t.Errorf("unexpected attempts for index %d: got %d expected %d", i, attempts[i], expected)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoWithActionFail(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		worker := func(idx int) work.Action {
+			if idx == n-1 {
+				return work.Fail
+			}
+			return work.Done
+		}
+		err := work.DoWithAction(n, worker, nil, 0)
+		if !errors.Is(err, work.ErrFailed) {
+			t.Errorf("expected failure, got %v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithActionTooManyRetries(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		worker := func(idx int) work.Action {
+			return work.Retry
+		}
+		err := work.DoWithAction(n, worker, nil, 3)
+		if !errors.Is(err, work.ErrTooManyRetries) {
+			t.Errorf("expected too many retries, got %v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithActionRetries(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu       sync.Mutex
+			attempts = make([]int, n)
+		)
+		// item i is retried i%3 times
+		worker := func(idx int) work.Action {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts[idx]++
+			if attempts[idx] <= idx%3 {
+				return work.Retry
+			}
+			return work.Done
+		}
+		retries, err := work.DoWithActionRetries(n, worker, nil, 2*n)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(retries) != n {
+			t.Errorf("unexpected retries size: got %d expected %d", len(retries), n)
+			t.FailNow()
+		}
+		for i, r := range retries {
+			if r != i%3 {
+				t.Errorf("unexpected retries for index %d: got %d expected %d", i, r, i%3)
+				t.FailNow()
+			}
+		}
+	}
+}
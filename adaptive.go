@@ -0,0 +1,50 @@
+package work
+
+import "sync/atomic"
+
+// AdaptiveConfig configures WithAdaptiveConcurrency.
+type AdaptiveConfig struct {
+	// Window is the number of worker results over which the error rate is computed, 10 if not positive.
+	Window int
+	// Threshold is the error rate, in [0, 1], above which the limit is decreased.
+	Threshold float64
+	// Decrease is the factor, in (0, 1), applied to the limit when decreased, 0.5 if not set.
+	Decrease float64
+	// Min is the lowest limit, 1 if not positive.
+	Min int
+	// OnChange, if set, is called with the new limit every time it changes.
+	// It must not block.
+	OnChange func(limit int)
+}
+
+// adapt records the result of a worker and updates the limit of running workers
+// at the end of every window of WithAdaptiveConcurrency.
+func (b *Batch) adapt(failed bool) {
+	cfg := b.adaptive
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.windowN++
+	if failed {
+		b.windowErrs++
+	}
+	if b.windowN < cfg.Window {
+		return
+	}
+	limit := int(b.limit)
+	if float64(b.windowErrs)/float64(b.windowN) > cfg.Threshold {
+		limit = int(float64(limit) * cfg.Decrease)
+		if limit < cfg.Min {
+			limit = cfg.Min
+		}
+	} else if limit < b.max {
+		limit++
+	}
+	b.windowN, b.windowErrs = 0, 0
+	if limit == int(b.limit) {
+		return
+	}
+	atomic.StoreInt64(&b.limit, int64(limit))
+	if cfg.OnChange != nil {
+		cfg.OnChange(limit)
+	}
+}
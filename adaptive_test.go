@@ -0,0 +1,46 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWithAdaptiveConcurrency(t *testing.T) {
+	const n, max = 200, 8
+	var (
+		mu     sync.Mutex
+		limits []int
+	)
+	cfg := work.AdaptiveConfig{
+		Window:    10,
+		Threshold: 0.5,
+		OnChange: func(limit int) {
+			mu.Lock()
+			limits = append(limits, limit)
+			mu.Unlock()
+		},
+	}
+	// the first half fails, then the downstream recovers
+	worker := func(idx int) error {
+		if idx < n/2 {
+			return fmt.Errorf("fail %d", idx)
+		}
+		return nil
+	}
+	err := work.DoNWithError(n, worker, nil, max, work.WithFailureThreshold(n), work.WithAdaptiveConcurrency(cfg))
+	if err == nil {
+		t.Errorf("expected the worker errors")
+		t.FailNow()
+	}
+	if len(limits) < 4 || fmt.Sprint(limits[:3]) != "[4 2 1]" {
+		t.Errorf("expected the limit to be halved down to 1, got %v", limits)
+		t.FailNow()
+	}
+	if last := limits[len(limits)-1]; last <= 1 || last > max {
+		t.Errorf("expected the limit to increase again, got %v", limits)
+		t.FailNow()
+	}
+}
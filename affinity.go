@@ -0,0 +1,70 @@
+package work
+
+import "sync"
+
+// DoWithAffinity spawns workers with index 0 to n-1 on GOMAXPROCS goroutines.
+// Similar to DoNWithAffinity.
+func DoWithAffinity(n int, key func(idx int) int, worker, finalizer func(idx int)) {
+	DoNWithAffinity(n, key, worker, finalizer, numRoutines)
+}
+
+// DoNWithAffinity spawns workers with index 0 to n-1 on max goroutines.
+// All the indexes with the same key are run one after the other, in increasing order, by the same goroutine,
+// so that workers can safely reuse per goroutine state, such as a buffer or a connection.
+// Indexes with different keys may share a goroutine.
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+// If max is not positive, it defaults to GOMAXPROCS.
+func DoNWithAffinity(n int, key func(idx int) int, worker, finalizer func(idx int), max int) {
+	if n <= 0 {
+		return
+	}
+	if max <= 0 {
+		max = numRoutines
+	}
+	if max > n {
+		max = n
+	}
+	shards := make([][]int, max)
+	for idx := 0; idx < n; idx++ {
+		s := key(idx) % max
+		if s < 0 {
+			s += max
+		}
+		shards[s] = append(shards[s], idx)
+	}
+
+	var (
+		workc = make(chan int) // processed indexes
+		wg    sync.WaitGroup
+	)
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(shard []int) {
+			for _, idx := range shard {
+				worker(idx)
+				if finalizer != nil {
+					workc <- idx
+				}
+			}
+			wg.Done()
+		}(shard)
+	}
+	go func() {
+		wg.Wait()
+		close(workc)
+	}()
+
+	// buffer holds the indexes that cannot be finalized yet.
+	buffer := make(map[int]bool)
+	pos := 0
+	for idx := range workc {
+		buffer[idx] = true
+		for ; buffer[pos]; pos++ {
+			delete(buffer, pos)
+			finalizer(pos)
+		}
+	}
+}
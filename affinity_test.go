@@ -0,0 +1,72 @@
+package work_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithAffinity(t *testing.T) {
+	const keys = 3
+	for _, n := range indexes {
+		var (
+			mu   sync.Mutex
+			busy = make([]bool, keys)
+			seqs = make([][]int, keys) // indexes run for each key
+		)
+		key := func(idx int) int { return idx % keys }
+		worker := func(idx int) {
+			k := key(idx)
+			mu.Lock()
+			if busy[k] {
+				t.Errorf("indexes with key %d run concurrently", k)
+			}
+			busy[k] = true
+			seqs[k] = append(seqs[k], idx)
+			mu.Unlock()
+
+			time.Sleep(100 * time.Microsecond)
+
+			mu.Lock()
+			busy[k] = false
+			mu.Unlock()
+		}
+		var final []int
+		finalizer := func(idx int) {
+			final = append(final, idx)
+		}
+		work.DoNWithAffinity(n, key, worker, finalizer, 2)
+		for k, seq := range seqs {
+			for i := 1; i < len(seq); i++ {
+				if seq[i] < seq[i-1] {
+					t.Errorf("indexes with key %d ran out of order: %v", k, seq)
+					t.FailNow()
+				}
+			}
+		}
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			if i != idx {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoNWithAffinityNoMax(t *testing.T) {
+	const n = 8
+	results := make([]int, n)
+	work.DoNWithAffinity(n, func(idx int) int { return idx }, func(idx int) {
+		results[idx] = 1
+	}, nil, 0)
+	if m := count(results); m != n {
+		t.Errorf("unexpected results size: got %d expected %d", m, n)
+		t.FailNow()
+	}
+}
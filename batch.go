@@ -0,0 +1,1127 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Batch is a set of workers running in the background, as started by Start or StartN.
+type Batch struct {
+	parent    context.Context
+	ctx       context.Context // cancelled when the batch is aborted or completed
+	cancel    context.CancelFunc
+	n         int
+	max       int
+	worker    func(ctx context.Context, idx int) error
+	finalizer func(idx int) error
+	options
+
+	mu       sync.Mutex
+	err      error                      // first error encountered
+	cause    AbortCause                 // origin of err
+	cancels  map[int]context.CancelFunc // cancel functions of the running workers
+	dropped  map[int]bool               // indexes cancelled by CancelIndex
+	resumec  chan struct{}              // set while the batch is paused, closed on resume
+	failures []IndexError               // worker errors tolerated by WithFailureThreshold
+	finalc   map[int]chan struct{}      // channels returned by Finalized
+	finals   []uint64                   // finalized items
+	nfinals  int                        // number of finalized items
+	undo     []int                      // finalized items in order, used by WithRollback
+	over     bool                       // set once all items are processed
+
+	remaining []int         // items not dispatched yet, used by WithNextIndex
+	order     []int         // dispatch order, used by WithShuffle
+	failed    atomic.Bool   // set once an error aborted the batch
+	started   int64         // number of items handed to a worker
+	completed int64         // number of items handed to the finalizer
+	succeeded int64         // number of items handed to the finalizer that can be finalized
+	finished  int64         // number of processed items
+	watermark int           // last index of the uninterrupted sequence of finalized items
+	peak      int           // largest number of items waiting to be finalized
+	pending   []int         // finalized items not flushed yet, used by WithFinalizerBatch
+	flushed   int           // last index flushed, used by WithFinalizerBatch
+	running   int64         // number of running workers
+	stalled   chan struct{} // closed when the finalizer times out, used by WithFinalizerTimeout and Drain
+	stallOnce sync.Once
+	active    int64         // number of dispatched workers not done yet, used by WithRuntimeMax and WithAdaptiveConcurrency
+	activec   chan struct{} // signaled when a worker is done, used by WithRuntimeMax and WithAdaptiveConcurrency
+	done      chan struct{} // closed when the batch is over
+	spec      speculation   // used by WithSpeculative
+	backlogc  chan struct{} // signaled when the finalizer progressed, used by WithFinalizerBackpressure
+	idle      atomic.Bool   // set while the finalizer waits for items, used by WithFinalizerBackpressure
+
+	received   int64 // number of items received by the finalizer, used by WithFinalizerBackpressure
+	dispatched int64 // number of items handed to a worker, only accessed by the dispatcher, used by WithFinalizerBackpressure
+
+	limit      int64 // current limit of running workers, used by WithAdaptiveConcurrency
+	windowN    int   // number of worker results in the current window, used by WithAdaptiveConcurrency
+	windowErrs int   // number of worker errors in the current window, used by WithAdaptiveConcurrency
+
+	fanc  []chan int     // items handed over to the finalizers of WithFinalizers
+	fanwg sync.WaitGroup // finalizers of WithFinalizers
+
+	nextPos int // position of the next item to be finalized, used by WithOrderCheck
+
+	finalizing sync.Mutex // held while an item is finalized, used by Drain
+	drained    bool       // set when Drain stopped the finalizer
+
+	progressMu sync.Mutex // serializes the calls to the callback of WithProgressEvery
+	reported   int        // number of processed items last reported to the callback of WithProgressEvery
+}
+
+// completion is sent by a worker to the finalizer routine once it is done.
+type completion struct {
+	idx  int
+	ok   bool // the item can be finalized
+	skip bool // the item must not be finalized but does not hold back the following ones
+	done bool // the item was skipped by WithSkip and does not interrupt the watermark
+}
+
+// Start spawns workers with index 0 to n-1 in the background, limiting their numbers by GOMAXPROCS.
+// Each worker receives its own context, derived from ctx, which is cancelled when processing is aborted.
+// The first error encountered aborts all processing and is then returned by Wait.
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+func Start(ctx context.Context, n int, worker func(ctx context.Context, idx int) error, finalizer func(idx int) error, opts ...Option) *Batch {
+	return StartN(ctx, n, worker, finalizer, numRoutines, opts...)
+}
+
+// StartN spawns workers with index 0 to n-1 in the background, limiting their numbers by max.
+// Similar to Start.
+func StartN(ctx context.Context, n int, worker func(ctx context.Context, idx int) error, finalizer func(idx int) error, max int, opts ...Option) *Batch {
+	b := newBatch(ctx, n, worker, finalizer, max, opts)
+	go b.run()
+	return b
+}
+
+func newBatch(ctx context.Context, n int, worker func(ctx context.Context, idx int) error, finalizer func(idx int) error, max int, opts []Option) *Batch {
+	bctx, cancel := context.WithCancel(ctx)
+	o := newOptions(opts)
+	if o.clock == nil {
+		o.clock = realClock{}
+	}
+	b := &Batch{
+		parent:    ctx,
+		ctx:       bctx,
+		cancel:    cancel,
+		n:         n,
+		max:       max,
+		worker:    worker,
+		finalizer: finalizer,
+		options:   o,
+		cancels:   make(map[int]context.CancelFunc),
+		watermark: -1,
+		activec:   make(chan struct{}, 1),
+		backlogc:  make(chan struct{}, 1),
+		stalled:   make(chan struct{}),
+		flushed:   -1,
+		done:      make(chan struct{}),
+	}
+	if len(b.finalizers) > 0 {
+		finalizer = b.fanOut(finalizer)
+		b.finalizer = finalizer
+	}
+	if b.tracer != nil && finalizer != nil {
+		finalizer = tracedFinalizer(ctx, b.tracer, finalizer)
+		b.finalizer = finalizer
+	}
+	if b.flushSize > 0 {
+		b.finalizer = b.accumulate(finalizer)
+	}
+	if b.singleflight != nil {
+		b.worker = shared(b.worker, b.singleflight)
+	}
+	if b.tracer != nil {
+		b.worker = traced(b.tracer, b.worker)
+	}
+	if b.adaptive != nil {
+		b.limit = int64(max)
+	}
+	if b.orderWindow > 0 && !b.alwaysFinalize {
+		// the order is relaxed on purpose
+		b.orderCheck = false
+	}
+	return b
+}
+
+// Wait blocks until all workers and the finalizer are done and returns the first error encountered.
+// If the parent context is cancelled before all items were processed, its error is returned.
+func (b *Batch) Wait() error {
+	<-b.done
+	return b.err
+}
+
+// Done returns a channel that is closed once all workers and the finalizer are done.
+func (b *Batch) Done() <-chan struct{} {
+	return b.done
+}
+
+// Context returns a context derived from the one given to Start that is cancelled as soon as the batch
+// is aborted, by an error or the cancellation of its parent, or once it has completed,
+// whichever happens first.
+// It lets goroutines outside of the batch react to its abort.
+func (b *Batch) Context() context.Context {
+	return b.ctx
+}
+
+// CancelIndex cancels the context of the worker with index idx, leaving the other workers untouched.
+// If the worker has not started yet, it will not be run.
+// The error returned by a cancelled worker is ignored and the finalizer is not called
+// for its index, which does not hold back the finalization of the following ones.
+// Cancelling an index whose worker has already returned has no effect.
+func (b *Batch) CancelIndex(idx int) {
+	b.mu.Lock()
+	if b.dropped == nil {
+		b.dropped = make(map[int]bool)
+	}
+	b.dropped[idx] = true
+	if cancel, ok := b.cancels[idx]; ok {
+		cancel()
+	}
+	b.mu.Unlock()
+}
+
+// Finalized returns a channel that is closed once the item with index idx has been finalized,
+// or once its worker succeeded if the batch has no finalizer.
+// The channel of an item that was already finalized is closed.
+// The channel of an item that is never finalized, because it failed or the batch was aborted, is never closed:
+// use Done to stop waiting on it.
+func (b *Batch) Finalized(idx int) <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.finalc[idx]; ok {
+		return c
+	}
+	c := make(chan struct{})
+	if idx >= 0 && idx < len(b.finals)*64 && b.finals[idx/64]&(1<<(idx%64)) != 0 {
+		close(c)
+	}
+	if b.finalc == nil {
+		b.finalc = make(map[int]chan struct{})
+	}
+	b.finalc[idx] = c
+	return c
+}
+
+// markFinalized records that the item with index idx was finalized and notifies the callers of Finalized.
+func (b *Batch) markFinalized(idx int) {
+	b.mu.Lock()
+	if b.finals == nil {
+		b.finals = make([]uint64, (b.n+63)/64)
+	}
+	b.finals[idx/64] |= 1 << (idx % 64)
+	b.nfinals++
+	if b.rollback != nil {
+		b.undo = append(b.undo, idx)
+	}
+	if c, ok := b.finalc[idx]; ok {
+		close(c)
+	}
+	b.mu.Unlock()
+}
+
+// Cancel aborts the batch with context.Canceled, without waiting for the running workers:
+// no more workers are started and the finalizer is still called on the items whose worker completed,
+// in order, up to the first one that was not processed. Use Wait to wait for the batch to be over:
+// once it returns, all these items were finalized. The items completed past the first one that
+// was not processed are not finalized and Drain reports their number.
+// Cancelling a batch that is over has no effect.
+func (b *Batch) Cancel() {
+	b.stop(CauseCanceled, context.Canceled)
+}
+
+// Progress returns the number of items processed so far, finalized if the batch has a finalizer,
+// and the total number of items.
+func (b *Batch) Progress() (done, total int) {
+	return int(atomic.LoadInt64(&b.finished)), b.n
+}
+
+// Shutdown aborts the batch with context.Canceled and waits up to grace for the running workers to return.
+// It returns the number of workers that were still running when grace expired,
+// 0 meaning that all of them returned in time.
+// Stragglers keep running in the background: Wait returns once they are done.
+func (b *Batch) Shutdown(grace time.Duration) int {
+	b.stop(CauseCanceled, context.Canceled)
+	t := b.clock.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-b.done:
+		return 0
+	case <-t.C():
+		return int(atomic.LoadInt64(&b.running))
+	}
+}
+
+// Drain aborts the batch with context.Canceled and lets the finalizer go on until deadline
+// with the items whose worker completed, in order, up to the first one that was not processed.
+// The finalizer is then stopped, once done with the current item, which Drain waits for, and Drain returns
+// the number of items whose worker completed but that were not finalized,
+// 0 meaning that no completed work was lost.
+// Workers still running at the deadline are not accounted for: Wait returns once they are done.
+func (b *Batch) Drain(deadline time.Time) int {
+	b.stop(CauseCanceled, context.Canceled)
+	t := b.clock.NewTimer(deadline.Sub(b.clock.Now()))
+	defer t.Stop()
+	select {
+	case <-b.done:
+	case <-t.C():
+		b.stallOnce.Do(func() {
+			b.mu.Lock()
+			b.drained = true
+			b.mu.Unlock()
+			close(b.stalled)
+		})
+		b.waitFinalizing()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(atomic.LoadInt64(&b.succeeded)) - b.nfinals
+}
+
+// waitFinalizing waits for the item being finalized when the finalizer was stopped by Drain.
+// A finalizer that timed out is not waited for.
+func (b *Batch) waitFinalizing() {
+	b.mu.Lock()
+	drained := b.drained
+	b.mu.Unlock()
+	if drained {
+		b.finalizing.Lock()
+		b.finalizing.Unlock()
+	}
+}
+
+// Pause stops the dispatching of new workers until Resume is called.
+// Running workers and the finalizer are not affected.
+// Pausing an already paused batch has no effect.
+func (b *Batch) Pause() {
+	b.mu.Lock()
+	if b.resumec == nil {
+		b.resumec = make(chan struct{})
+	}
+	b.mu.Unlock()
+}
+
+// Resume restarts the dispatching of workers stopped by Pause.
+// Resuming a batch that is not paused has no effect.
+func (b *Batch) Resume() {
+	b.mu.Lock()
+	if b.resumec != nil {
+		close(b.resumec)
+		b.resumec = nil
+	}
+	b.mu.Unlock()
+}
+
+// wait blocks while the batch is paused and reports whether dispatching can go on.
+func (b *Batch) wait() bool {
+	for {
+		b.mu.Lock()
+		resumec := b.resumec
+		b.mu.Unlock()
+		if resumec == nil {
+			return b.ctx.Err() == nil
+		}
+		select {
+		case <-resumec:
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+}
+
+// throttled reports whether the number of running workers is limited by WithRuntimeMax
+// or WithAdaptiveConcurrency.
+func (b *Batch) throttled() bool {
+	return b.runtimeMax || b.adaptive != nil
+}
+
+// throttle blocks while the batch runs as many workers as allowed by SetRuntimeMax
+// or WithAdaptiveConcurrency and reports whether dispatching can go on.
+func (b *Batch) throttle() bool {
+	for {
+		var (
+			max     int
+			changed <-chan struct{}
+		)
+		if b.runtimeMax {
+			max, changed = loadRuntimeMax()
+		}
+		if b.adaptive != nil {
+			if limit := int(atomic.LoadInt64(&b.limit)); max < 1 || limit < max {
+				max = limit
+			}
+		}
+		if max < 1 || atomic.LoadInt64(&b.active) < int64(max) {
+			return true
+		}
+		select {
+		case <-b.activec:
+		case <-changed:
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+}
+
+// waitGate polls the gate set by WithGate until it opens and reports whether dispatching can go on.
+func (b *Batch) waitGate() bool {
+	for !b.gate() {
+		if !b.sleep(b.gateInterval) {
+			return false
+		}
+	}
+	return b.ctx.Err() == nil
+}
+
+// sleep pauses for the given duration and reports whether dispatching can go on.
+func (b *Batch) sleep(d time.Duration) bool {
+	t := b.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-b.ctx.Done():
+		return false
+	}
+}
+
+// fail records the error returned by the worker for index idx and aborts all processing,
+// unless the error is tolerated by WithFailureThreshold.
+func (b *Batch) fail(idx int, err error, cause AbortCause) {
+	if b.failureThreshold == 0 {
+		b.abort(cause, err)
+		return
+	}
+	b.mu.Lock()
+	b.failures = append(b.failures, IndexError{idx, err})
+	if len(b.failures) <= b.failureThreshold {
+		b.mu.Unlock()
+		return
+	}
+	err = joinIndexErrors(b.failures)
+	b.mu.Unlock()
+	b.abort(CauseThreshold, err)
+}
+
+// abort records the first error and stops all processing.
+func (b *Batch) abort(cause AbortCause, err error) {
+	b.failed.Store(true)
+	b.stop(cause, err)
+}
+
+// stop records err unless an error was already recorded and stops all processing.
+// Unlike abort, the finalizer still processes the items of the workers that completed.
+func (b *Batch) stop(cause AbortCause, err error) {
+	b.mu.Lock()
+	if b.err == nil && !b.over {
+		b.err, b.cause = err, cause
+	}
+	b.mu.Unlock()
+	b.cancel()
+}
+
+// run processes all items with a concurrency of max and returns when they are done.
+func (b *Batch) run() {
+	defer close(b.done)
+	defer b.cancel()
+
+	var (
+		donec = make(chan struct{}, b.max)           // worker throttling
+		workc = make(chan completion, b.coalesced()) // results from workers
+		fdone = make(chan struct{})                  // closed when the finalizer is done
+		wg    sync.WaitGroup
+		rnd   *rand.Rand
+	)
+	if b.jitter > 0 {
+		rnd = rand.New(rand.NewSource(b.clock.Now().UnixNano()))
+	}
+
+	if b.finalizer != nil {
+		go func() {
+			if b.orderWindow > 0 && !b.alwaysFinalize {
+				b.finalizeWindow(workc)
+			} else {
+				b.finalize(workc)
+			}
+			if b.flushSize > 0 {
+				b.flushRemaining()
+			}
+			if b.fanc != nil {
+				b.fanOutDone()
+			}
+			close(fdone)
+		}()
+	} else {
+		close(fdone)
+	}
+
+	if b.sampler != nil {
+		var (
+			stopc = make(chan struct{})
+			wgs   sync.WaitGroup
+		)
+		wgs.Add(1)
+		go func() {
+			b.sample(stopc)
+			wgs.Done()
+		}()
+		defer func() {
+			close(stopc)
+			wgs.Wait()
+		}()
+	}
+
+	// warm-up runs are not part of the batch
+	for _, idx := range b.warmup {
+		if b.ctx.Err() != nil {
+			break
+		}
+		_ = b.worker(b.ctx, idx)
+	}
+
+dispatch:
+	for i := 0; i < b.n && b.ctx.Err() == nil; i++ {
+		select {
+		case donec <- struct{}{}:
+		case <-b.ctx.Done():
+			break dispatch
+		}
+		if !b.wait() {
+			<-donec
+			break
+		}
+		idx := b.next(i)
+		// skipped items are handed over to the finalizer without using the resources of the workers
+		skipped := b.skip != nil && b.skip(idx)
+		if !skipped && b.backlogHigh > 0 && b.finalizer != nil && !b.waitBacklog() {
+			<-donec
+			break
+		}
+		if !skipped && b.gate != nil && !b.waitGate() {
+			<-donec
+			break
+		}
+		if !skipped && b.throttled() && !b.throttle() {
+			<-donec
+			break
+		}
+		if !skipped && b.limiter != nil && !b.limiter.acquire(b.ctx, b.priority) {
+			<-donec
+			break
+		}
+		if !skipped && b.throttled() {
+			atomic.AddInt64(&b.active, 1)
+		}
+		if b.backlogHigh > 0 {
+			b.dispatched++
+		}
+		// the jitter is drawn by the dispatcher since rnd is not safe for concurrent use
+		var jitter time.Duration
+		if rnd != nil && !skipped {
+			jitter = time.Duration(rnd.Int63n(int64(b.jitter)))
+		}
+		wg.Add(1)
+		go func(idx int) {
+			if b.yield {
+				// let the goroutines woken up by the previous workers run first
+				runtime.Gosched()
+			}
+			var c completion
+			switch {
+			case skipped:
+				c = b.skipItem(idx)
+			case jitter == 0 || b.sleep(jitter):
+				c = b.work(idx)
+			default:
+				// an item whose jitter was interrupted is not processed
+				c = completion{idx: idx}
+			}
+			if !skipped && b.limiter != nil {
+				b.limiter.release()
+			}
+			if !skipped && b.throttled() {
+				atomic.AddInt64(&b.active, -1)
+				select {
+				case b.activec <- struct{}{}:
+				default:
+				}
+			}
+			if b.finalizer != nil {
+				atomic.AddInt64(&b.completed, 1)
+				if c.ok {
+					atomic.AddInt64(&b.succeeded, 1)
+				}
+				select {
+				case workc <- c:
+				case <-b.stalled:
+				}
+			}
+			<-donec
+			wg.Done()
+		}(idx)
+	}
+
+	// wait for workers
+	wg.Wait()
+	// all items were handed over to the finalizer
+	close(workc)
+	// wait for finalizer, unless it stalled
+	select {
+	case <-fdone:
+	case <-b.stalled:
+		b.waitFinalizing()
+	}
+	// from now on, the error is only set here
+	b.mu.Lock()
+	b.over = true
+	b.mu.Unlock()
+
+	if b.err == nil && len(b.failures) > 0 {
+		b.err, b.cause = joinIndexErrors(b.failures), CauseWorker
+	}
+	if b.err == nil && b.finished < int64(b.n) {
+		b.err, b.cause = b.parent.Err(), CauseCanceled
+	}
+
+	if b.flushSize > 0 && b.watermark >= 0 && (b.flushed < 0 || b.index(b.flushed) < b.index(b.watermark)) {
+		// items are only finalized once flushed
+		b.watermark = b.flushed
+	}
+
+	if b.batchFinalizer != nil && (b.err == nil || b.batchFinalizerOnAbort) {
+		if err := b.batchFinalizer(b.err != nil); b.err == nil && err != nil {
+			b.err, b.cause = err, CauseBatchFinalizer
+		}
+	}
+
+	if b.rollback != nil && b.err != nil {
+		var errs []IndexError
+		for i := len(b.undo) - 1; i >= 0; i-- {
+			if err := b.rollback(b.undo[i]); err != nil {
+				errs = append(errs, IndexError{b.undo[i], err})
+			}
+		}
+		if len(errs) > 0 {
+			b.err = errors.Join(b.err, joinIndexErrors(errs))
+		}
+	}
+
+	if b.abortCause && b.err != nil {
+		b.err = &AbortError{Cause: b.cause, Err: b.err}
+	}
+}
+
+// sample reports the backlogs of the batch to the sampler set by WithQueueSampler
+// until stopc is closed.
+func (b *Batch) sample(stopc <-chan struct{}) {
+	for {
+		select {
+		case <-b.clock.After(b.sampleInterval):
+			pending := b.n - int(atomic.LoadInt64(&b.started))
+			backlog := int(atomic.LoadInt64(&b.completed) - atomic.LoadInt64(&b.finished))
+			b.sampler(pending, backlog)
+		case <-stopc:
+			return
+		}
+	}
+}
+
+// index returns the index of the item at position pos in the processing order.
+func (b *Batch) index(pos int) int {
+	if b.reverseFinalize {
+		return b.n - 1 - pos
+	}
+	return pos
+}
+
+// next returns the index of the i-th item to be dispatched.
+func (b *Batch) next(i int) int {
+	if b.shuffle && b.nextIndex == nil {
+		if b.order == nil {
+			b.order = rand.New(rand.NewSource(b.shuffleSeed)).Perm(b.n)
+		}
+		return b.order[i]
+	}
+	if b.nextIndex == nil {
+		return b.index(i)
+	}
+	if b.remaining == nil {
+		b.remaining = make([]int, b.n)
+		for i := range b.remaining {
+			b.remaining[i] = i
+		}
+	}
+	idx := b.nextIndex(b.remaining)
+	j := sort.SearchInts(b.remaining, idx)
+	if j == len(b.remaining) || b.remaining[j] != idx {
+		panic(fmt.Sprintf("work: next index %d is not a remaining one", idx))
+	}
+	b.remaining = append(b.remaining[:j], b.remaining[j+1:]...)
+	return idx
+}
+
+// skipItem returns the completion of the item with index idx, skipped by WithSkip.
+func (b *Batch) skipItem(idx int) completion {
+	atomic.AddInt64(&b.started, 1)
+	b.processed()
+	if b.finalizeSkipped {
+		return completion{idx: idx, ok: true}
+	}
+	return completion{idx: idx, skip: true, done: true}
+}
+
+// work runs the worker for index idx and reports how its item must be finalized.
+func (b *Batch) work(idx int) completion {
+	atomic.AddInt64(&b.started, 1)
+	parent := b.ctx
+	if b.workerContext != nil {
+		parent = b.workerContext(parent, idx)
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	b.mu.Lock()
+	if b.ctx.Err() != nil {
+		b.mu.Unlock()
+		return completion{idx: idx}
+	}
+	if b.dropped[idx] {
+		b.mu.Unlock()
+		b.processed()
+		return completion{idx: idx, skip: true}
+	}
+	b.cancels[idx] = cancel
+	b.mu.Unlock()
+
+	atomic.AddInt64(&b.running, 1)
+	var (
+		panicked bool
+		err      error
+	)
+	if b.speculative > 0 {
+		panicked, err = b.speculate(ctx, idx)
+	} else {
+		panicked, err = b.call(ctx, idx)
+	}
+	atomic.AddInt64(&b.running, -1)
+	if b.adaptive != nil && b.ctx.Err() == nil {
+		b.adapt(err != nil)
+	}
+	if b.onComplete != nil {
+		b.onComplete(idx, err)
+	}
+
+	b.mu.Lock()
+	delete(b.cancels, idx)
+	dropped := b.dropped[idx]
+	b.mu.Unlock()
+
+	switch {
+	case dropped:
+		b.processed()
+		return completion{idx: idx, skip: true}
+	case err != nil && b.ctx.Err() != nil && !b.failed.Load() && !panicked:
+		// the worker was interrupted by the cancellation of the batch
+		return completion{idx: idx}
+	case err != nil:
+		cause := CauseWorker
+		if panicked {
+			cause = CausePanic
+		}
+		b.fail(idx, err, cause)
+		if !b.alwaysFinalize {
+			b.processed()
+			return completion{idx: idx, skip: true}
+		}
+	}
+	if b.finalizer == nil {
+		b.processed()
+		if err == nil {
+			b.markFinalized(idx)
+		}
+	}
+	return completion{idx: idx, ok: true}
+}
+
+// call runs the worker for index idx. If WithPanicConverter is set, a panic of the worker is recovered
+// and turned into the returned error, panicked being then true.
+func (b *Batch) call(ctx context.Context, idx int) (panicked bool, err error) {
+	if b.panicConverter != nil {
+		defer func() {
+			if r := recover(); r != nil {
+				panicked, err = true, b.panicConverter(idx, r, debug.Stack())
+			}
+		}()
+	}
+	return false, b.worker(ctx, idx)
+}
+
+// processed records that an item does not require any more processing.
+// Without a finalizer, items are processed by workers, otherwise by the finalizer.
+func (b *Batch) processed() {
+	if b.finalizer == nil {
+		b.finish()
+	}
+}
+
+// finalize calls the finalizer on the items received from workc, in increasing index order
+// or decreasing if WithReverseFinalize is set.
+// Once the batch is aborted by an error, no more items are finalized.
+// If it is cancelled instead, the items received so far are still finalized, in order,
+// up to the first one that was not processed.
+// It returns when workc is closed.
+func (b *Batch) finalize(workc <-chan completion) {
+	// buffer holds results that cannot be finalized yet.
+	buffer := make(map[int]completion)
+	// current index to be processed
+	pos := 0
+	// whether all items so far were successfully finalized
+	uninterrupted := true
+	for c := range workc {
+		b.idle.Store(false)
+		buffer[c.idx] = c
+		received := 1
+		if b.coalesce {
+			received += drain(workc, buffer)
+		}
+		if b.backlogHigh > 0 {
+			atomic.AddInt64(&b.received, int64(received))
+		}
+		if len(buffer) > b.peak {
+			b.peak = len(buffer)
+		}
+		// process the results that were already received
+		// ensuring they are processed in order
+		for ; b.alwaysFinalize || !b.failed.Load(); pos++ {
+			idx := b.index(pos)
+			c, found := buffer[idx]
+			if !found || !c.ok && !c.skip {
+				// no more result for the current position
+				break
+			}
+			delete(buffer, idx)
+			if c.skip {
+				b.skipOrder(pos)
+				if !c.done {
+					uninterrupted = false
+				} else if uninterrupted {
+					b.watermark = idx
+				}
+			} else if ok, err := b.finalizeItem(idx); !ok {
+				return
+			} else if err != nil {
+				uninterrupted = false
+				b.abort(CauseFinalizer, err)
+				if !b.alwaysFinalize {
+					break
+				}
+			} else if uninterrupted {
+				b.watermark = idx
+			}
+			b.finish()
+		}
+		b.caughtUp()
+	}
+
+	if b.alwaysFinalize {
+		// items may be missing if processing was aborted,
+		// finalize the remaining ones in order
+		for ; pos < b.n; pos++ {
+			idx := b.index(pos)
+			if !buffer[idx].ok {
+				b.skipOrder(pos)
+				continue
+			}
+			if ok, err := b.finalizeItem(idx); !ok {
+				return
+			} else if err != nil {
+				b.abort(CauseFinalizer, err)
+			}
+			b.finish()
+		}
+	}
+}
+
+// coalesced returns the number of completions that workers can hand over
+// without waiting for the finalizer, as set by WithCoalescing.
+func (b *Batch) coalesced() int {
+	if !b.coalesce {
+		return 0
+	}
+	return b.max
+}
+
+// finish records that an item was processed, by the finalizer if any.
+func (b *Batch) finish() {
+	done := atomic.AddInt64(&b.finished, 1)
+	if b.progressEvery > 0 && (done%int64(b.progressEvery) == 0 || done == int64(b.n)) {
+		b.progress(int(done))
+	}
+	if b.backlogHigh > 0 {
+		select {
+		case b.backlogc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// progress calls the callback set by WithProgressEvery, unless it was already called
+// with a larger number of processed items.
+func (b *Batch) progress(done int) {
+	b.progressMu.Lock()
+	defer b.progressMu.Unlock()
+	if done <= b.reported {
+		return
+	}
+	b.reported = done
+	b.progressFunc(done, b.n)
+}
+
+// caughtUp records that the finalizer is done with the items received so far
+// and waits for more.
+func (b *Batch) caughtUp() {
+	if b.backlogHigh > 0 {
+		b.idle.Store(true)
+		select {
+		case b.backlogc <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitBacklog blocks while the backlog of the finalizer is over the high-water mark
+// set by WithFinalizerBackpressure, until it drops to the low-water mark,
+// and reports whether dispatching can go on.
+func (b *Batch) waitBacklog() bool {
+	backlog := func() int64 {
+		return atomic.LoadInt64(&b.completed) - atomic.LoadInt64(&b.finished)
+	}
+	if backlog() < int64(b.backlogHigh) {
+		return true
+	}
+	for backlog() > int64(b.backlogLow) {
+		// an idle finalizer that received all the dispatched items waits for an item
+		// that was not dispatched yet, e.g. with WithShuffle.
+		// received is loaded first since the finalizer clears idle before updating it.
+		if atomic.LoadInt64(&b.received) == b.dispatched && b.idle.Load() {
+			return true
+		}
+		select {
+		case <-b.backlogc:
+		case <-b.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// drain moves the completions readily available from workc into buffer and returns their number.
+func drain(workc <-chan completion, buffer map[int]completion) int {
+	for n := 0; ; n++ {
+		select {
+		case c, ok := <-workc:
+			if !ok {
+				return n
+			}
+			buffer[c.idx] = c
+		default:
+			return n
+		}
+	}
+}
+
+// finalizeWindow is similar to finalize but lets items be finalized ahead of their turn
+// by up to the number of positions set by WithOrderWindow.
+// An item at position p is finalized as soon as all the items before position p-w are.
+func (b *Batch) finalizeWindow(workc <-chan completion) {
+	// buffer holds results that cannot be finalized yet.
+	buffer := make(map[int]completion)
+	// positions finalized ahead of pos
+	ahead := make(map[int]bool)
+	// first position not finalized yet
+	pos := 0
+	// whether all items so far were successfully finalized
+	uninterrupted := true
+	for c := range workc {
+		b.idle.Store(false)
+		buffer[c.idx] = c
+		received := 1
+		if b.coalesce {
+			received += drain(workc, buffer)
+		}
+		if b.backlogHigh > 0 {
+			atomic.AddInt64(&b.received, int64(received))
+		}
+		if len(buffer) > b.peak {
+			b.peak = len(buffer)
+		}
+		for p := pos; p <= pos+b.orderWindow && p < b.n && !b.failed.Load(); p++ {
+			idx := b.index(p)
+			c, found := buffer[idx]
+			if !found || !c.ok && !c.skip {
+				continue
+			}
+			delete(buffer, idx)
+			if c.skip {
+				if !c.done {
+					uninterrupted = false
+				}
+			} else if ok, err := b.finalizeItem(idx); !ok {
+				return
+			} else if err != nil {
+				b.abort(CauseFinalizer, err)
+				break
+			}
+			b.finish()
+			ahead[p] = true
+			for ; ahead[pos]; pos++ {
+				delete(ahead, pos)
+				if uninterrupted {
+					b.watermark = b.index(pos)
+				}
+			}
+		}
+		b.caughtUp()
+	}
+}
+
+// accumulate returns a finalizer calling f, if set, and adding the items to the pending batch,
+// flushing it once it is full as set by WithFinalizerBatch.
+func (b *Batch) accumulate(f func(idx int) error) func(idx int) error {
+	return func(idx int) error {
+		if f != nil {
+			if err := f(idx); err != nil {
+				return err
+			}
+		}
+		// a retried item is already pending
+		if n := len(b.pending); n == 0 || b.pending[n-1] != idx {
+			b.pending = append(b.pending, idx)
+		}
+		if len(b.pending) < b.flushSize {
+			return nil
+		}
+		return b.flush()
+	}
+}
+
+// flush hands the pending items over to the function set by WithFinalizerBatch.
+// They are kept pending if it fails.
+func (b *Batch) flush() error {
+	if err := b.flushFunc(b.pending); err != nil {
+		return err
+	}
+	b.flushed = b.pending[len(b.pending)-1]
+	b.pending = nil
+	return nil
+}
+
+// flushRemaining flushes the last, partial, batch of items once the finalizer is done,
+// unless processing was aborted.
+func (b *Batch) flushRemaining() {
+	select {
+	case <-b.stalled:
+		return
+	default:
+	}
+	if len(b.pending) == 0 || b.failed.Load() && !b.alwaysFinalize {
+		return
+	}
+	if err := b.flush(); err != nil {
+		b.abort(CauseFinalizer, err)
+	}
+}
+
+// finalizeItem validates the item with index idx, as set by WithValidate, calls the finalizer on it
+// and returns the first error.
+// It reports false if the call outlasted the duration set by WithFinalizerTimeout,
+// in which case the batch was aborted, or if the finalizer was stopped by Drain:
+// the finalizer must not go on.
+func (b *Batch) finalizeItem(idx int) (bool, error) {
+	b.finalizing.Lock()
+	defer b.finalizing.Unlock()
+	select {
+	case <-b.stalled:
+		// stopped by Drain
+		return false, nil
+	default:
+	}
+	if b.orderCheck {
+		if err := b.checkOrder(idx); err != nil {
+			b.abort(CauseFinalizer, err)
+			return true, err
+		}
+	}
+	if b.validate != nil {
+		if err := b.validate(idx); err != nil {
+			err = IndexError{idx, err}
+			b.abort(CauseValidation, err)
+			return true, err
+		}
+	}
+	if b.finalizerTimeout <= 0 {
+		err := b.callFinalizer(idx)
+		if err == nil {
+			b.markFinalized(idx)
+		}
+		return true, err
+	}
+	t := b.clock.AfterFunc(b.finalizerTimeout, func() {
+		b.stallOnce.Do(func() {
+			b.abort(CauseFinalizer, IndexError{idx, ErrFinalizerTimeout})
+			close(b.stalled)
+		})
+	})
+	err := b.callFinalizer(idx)
+	if !t.Stop() {
+		<-b.stalled
+		return false, nil
+	}
+	if err == nil {
+		b.markFinalized(idx)
+	}
+	return true, err
+}
+
+// checkOrder verifies that the item with index idx is the next one in the finalizer order,
+// as set by WithOrderCheck. Positions passed over by the finalizer are recorded by skipOrder.
+func (b *Batch) checkOrder(idx int) error {
+	// index maps positions to indexes and back
+	pos := b.index(idx)
+	if pos != b.nextPos {
+		if pos > b.nextPos {
+			// do not report the following items
+			b.nextPos = pos + 1
+		}
+		return IndexError{idx, ErrOutOfOrder}
+	}
+	b.nextPos++
+	return nil
+}
+
+// skipOrder records that the finalizer passed over the item at position pos without finalizing it,
+// e.g. because it was skipped by WithSkip or its worker failed within WithFailureThreshold.
+func (b *Batch) skipOrder(pos int) {
+	if b.orderCheck && pos == b.nextPos {
+		b.nextPos++
+	}
+}
+
+// callFinalizer calls the finalizer on index idx, retrying it as set by WithFinalizerRetry.
+func (b *Batch) callFinalizer(idx int) error {
+	err := b.finalizer(idx)
+	for i := 1; err != nil && i < b.finalizerAttempts; i++ {
+		if b.finalizerBackoff != nil {
+			<-b.clock.After(b.finalizerBackoff(i))
+		}
+		err = b.finalizer(idx)
+	}
+	return err
+}
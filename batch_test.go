@@ -0,0 +1,437 @@
+package work_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestStart(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(ctx context.Context, idx int) error {
+			results[idx] = 1
+			return nil
+		}
+		b := work.Start(context.Background(), n, worker, nil)
+		if err := b.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestBatchCancelIndex(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		cancelled := n / 2
+		worker := func(ctx context.Context, idx int) error {
+			if idx == cancelled {
+				// only returns once cancelled
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		b := work.StartN(context.Background(), n, worker, finalizer, n)
+		b.CancelIndex(cancelled)
+		if err := b.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(final) != n-1 {
+			t.Errorf("unexpected final size: got %d expected %d", len(final), n-1)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			expected := i
+			if i >= cancelled {
+				expected++
+			}
+			if idx != expected {
+				t.Errorf("unexpected finalized items: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestBatchPause(t *testing.T) {
+	const n = 10
+	var (
+		started = make(chan int, n)
+		release = make(chan struct{})
+	)
+	worker := func(ctx context.Context, idx int) error {
+		started <- idx
+		<-release
+		return nil
+	}
+	b := work.StartN(context.Background(), n, worker, nil, 2)
+	// wait for the first workers to be running, then pause
+	<-started
+	<-started
+	b.Pause()
+	b.Pause()
+	close(release)
+
+	// no new worker starts while paused
+	time.Sleep(10 * time.Millisecond)
+	if m := len(started); m != 0 {
+		t.Errorf("unexpected number of workers started while paused: %d", m)
+		t.FailNow()
+	}
+
+	b.Resume()
+	b.Resume()
+	if err := b.Wait(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if m := len(started); m != n-2 {
+		t.Errorf("unexpected number of workers started: got %d expected %d", m, n-2)
+		t.FailNow()
+	}
+}
+
+func TestBatchShutdown(t *testing.T) {
+	const n = 4
+	var (
+		started = make(chan struct{})
+		stuck   = make(chan struct{})
+	)
+	defer close(stuck)
+	worker := func(ctx context.Context, idx int) error {
+		if idx == 0 {
+			// ignores cancellation
+			close(started)
+			<-stuck
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	b := work.StartN(context.Background(), n, worker, nil, n)
+	<-started
+	if m := b.Shutdown(10 * time.Millisecond); m != 1 {
+		t.Errorf("unexpected number of stragglers: got %d expected 1", m)
+		t.FailNow()
+	}
+}
+
+func TestBatchShutdownInTime(t *testing.T) {
+	const n = 4
+	worker := func(ctx context.Context, idx int) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	b := work.StartN(context.Background(), n, worker, nil, n)
+	if m := b.Shutdown(time.Second); m != 0 {
+		t.Errorf("unexpected number of stragglers: got %d expected 0", m)
+		t.FailNow()
+	}
+	if err := b.Wait(); err != context.Canceled {
+		t.Errorf("expected context error, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestBatchDrain(t *testing.T) {
+	const n = 4
+	var (
+		final    []int
+		entered  = make(chan struct{})
+		release  = make(chan struct{})
+		finished = make(chan struct{})
+		done     int32
+		alldone  = make(chan struct{})
+	)
+	worker := func(ctx context.Context, idx int) error {
+		if atomic.AddInt32(&done, 1) == n {
+			close(alldone)
+		}
+		return nil
+	}
+	finalizer := func(idx int) error {
+		if idx == 0 {
+			close(entered)
+			<-release
+			defer close(finished)
+		}
+		final = append(final, idx)
+		return nil
+	}
+	b := work.StartN(context.Background(), n, worker, finalizer, n)
+	<-entered
+	<-alldone
+	// the finalizer is stuck on the first item past the deadline
+	// and Drain waits for it
+	deadline := time.Now().Add(10 * time.Millisecond)
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	m := b.Drain(deadline)
+	select {
+	case <-finished:
+	default:
+		t.Errorf("Drain returned before the current item was finalized")
+		t.FailNow()
+	}
+	if m != n-1 {
+		t.Errorf("unexpected number of unflushed items: got %d expected %d", m, n-1)
+		t.FailNow()
+	}
+	if err := b.Wait(); err != context.Canceled {
+		t.Errorf("expected context error, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0]" || m+len(final) != n {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+}
+
+func TestBatchDrainInTime(t *testing.T) {
+	const n = 4
+	worker := func(ctx context.Context, idx int) error {
+		if idx < 2 {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	var (
+		final     []int
+		finalized = make(chan struct{})
+	)
+	finalizer := func(idx int) error {
+		final = append(final, idx)
+		if idx == 1 {
+			close(finalized)
+		}
+		return nil
+	}
+	b := work.StartN(context.Background(), n, worker, finalizer, n)
+	<-finalized
+	if m := b.Drain(time.Now().Add(time.Second)); m != 0 {
+		t.Errorf("unexpected number of unflushed items: got %d expected 0", m)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 1]" {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+}
+
+func TestBatchContext(t *testing.T) {
+	const n = 4
+	worker := func(ctx context.Context, idx int) error {
+		if idx == 0 {
+			return fmt.Errorf("fail")
+		}
+		<-ctx.Done()
+		return nil
+	}
+	b := work.StartN(context.Background(), n, worker, nil, n)
+	// a goroutine outside of the batch learns about the abort
+	ctx := b.Context()
+	<-ctx.Done()
+	<-b.Done()
+	if err := b.Wait(); err == nil || err.Error() != "fail" {
+		t.Errorf("expected worker error, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestBatchDone(t *testing.T) {
+	b := work.Start(context.Background(), 1, func(ctx context.Context, idx int) error {
+		return nil
+	}, nil)
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Errorf("batch not done")
+		t.FailNow()
+	}
+	if err := b.Context().Err(); err == nil {
+		t.Errorf("expected the batch context to be cancelled once completed")
+		t.FailNow()
+	}
+}
+
+func TestBatchFinalized(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		release := make(chan struct{})
+		worker := func(ctx context.Context, idx int) error {
+			if idx == n-1 {
+				<-release
+			}
+			return nil
+		}
+		b := work.StartN(context.Background(), n, worker, func(int) error { return nil }, n)
+		select {
+		case <-b.Finalized(0):
+		case <-time.After(5 * time.Second):
+			t.Errorf("item 0 not finalized")
+			t.FailNow()
+		}
+		last := b.Finalized(n - 1)
+		select {
+		case <-last:
+			t.Errorf("item %d finalized before its worker returned", n-1)
+			t.FailNow()
+		default:
+		}
+		close(release)
+		<-last
+		if err := b.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		// already finalized
+		select {
+		case <-b.Finalized(n / 2):
+		default:
+			t.Errorf("channel of a finalized item not closed")
+			t.FailNow()
+		}
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		started := make(chan struct{})
+		worker := func(ctx context.Context, idx int) error {
+			if idx == 0 {
+				close(started)
+				<-ctx.Done()
+			}
+			return nil
+		}
+		b := work.StartN(context.Background(), n, worker, nil, 1)
+		<-started
+		if done, total := b.Progress(); done != 0 || total != n {
+			t.Errorf("unexpected progress: %d/%d", done, total)
+			t.FailNow()
+		}
+		b.Cancel()
+		if err := b.Wait(); err != context.Canceled {
+			t.Errorf("expected context error, got %v", err)
+			t.FailNow()
+		}
+		// item 0 completed despite the cancellation
+		if done, _ := b.Progress(); done != 1 {
+			t.Errorf("unexpected progress after cancel: %d", done)
+			t.FailNow()
+		}
+		b.Cancel()
+	}
+}
+
+func TestBatchCancelDrainsPrefix(t *testing.T) {
+	const n = 64
+	rnd := rand.New(rand.NewSource(1))
+	for _, opts := range [][]work.Option{nil, {work.WithCoalescing()}} {
+		for run := 0; run < 200; run++ {
+			var (
+				succeeded = make([]int32, n)
+				cancelAt  = rnd.Intn(n)
+				b         *work.Batch
+				ready     = make(chan struct{})
+			)
+			worker := func(ctx context.Context, idx int) error {
+				<-ready
+				if idx == cancelAt {
+					b.Cancel()
+				}
+				// let the cancellation race with the completion of the other workers
+				if idx%3 == 0 {
+					runtime.Gosched()
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				atomic.StoreInt32(&succeeded[idx], 1)
+				return nil
+			}
+			var final []int
+			finalizer := func(idx int) error {
+				final = append(final, idx)
+				return nil
+			}
+			b = work.StartN(context.Background(), n, worker, finalizer, 8, opts...)
+			close(ready)
+			err := b.Wait()
+
+			var prefix []int
+			for i := range succeeded {
+				if succeeded[i] == 0 {
+					break
+				}
+				prefix = append(prefix, i)
+			}
+			if len(prefix) < n && err != context.Canceled {
+				t.Errorf("expected context error, got %v", err)
+				t.FailNow()
+			}
+			// no completed item of the prefix was dropped
+			if fmt.Sprint(final) != fmt.Sprint(prefix) {
+				t.Errorf("unexpected finalized items: got %v expected %v", final, prefix)
+				t.FailNow()
+			}
+			var completed int
+			for _, ok := range succeeded {
+				completed += int(ok)
+			}
+			if m := b.Drain(time.Now()); m != completed-len(final) {
+				t.Errorf("unexpected number of unfinalized items: got %d expected %d", m, completed-len(final))
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestBatchProgress(t *testing.T) {
+	for _, n := range indexes {
+		var final []int
+		b := work.Start(context.Background(), n, func(context.Context, int) error { return nil }, func(idx int) error {
+			final = append(final, idx)
+			return nil
+		})
+		if err := b.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if done, total := b.Progress(); done != n || total != n {
+			t.Errorf("unexpected progress: %d/%d", done, total)
+			t.FailNow()
+		}
+		// cancelling a completed batch has no effect
+		b.Cancel()
+		if err := b.Wait(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+	}
+}
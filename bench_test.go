@@ -0,0 +1,97 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+// spin keeps the processor busy for d.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// benchmarkLatency measures the latency of a goroutine waking up periodically
+// while CPU bound workers are running.
+func benchmarkLatency(b *testing.B, opts ...work.Option) {
+	var (
+		wg    sync.WaitGroup
+		stopc = make(chan struct{})
+		total time.Duration
+		ticks int
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			start := time.Now()
+			select {
+			case <-stopc:
+				return
+			case <-time.After(100 * time.Microsecond):
+			}
+			total += time.Since(start) - 100*time.Microsecond
+			ticks++
+		}
+	}()
+	n := 64 * b.N
+	work.Do(n, func(int) {
+		spin(50 * time.Microsecond)
+	}, nil, opts...)
+	close(stopc)
+	wg.Wait()
+	if ticks > 0 {
+		b.ReportMetric(float64(total.Nanoseconds())/float64(ticks), "latency-ns")
+	}
+}
+
+func BenchmarkContention(b *testing.B) {
+	// a no-op option forces the same code path
+	b.Run("default", func(b *testing.B) { benchmarkLatency(b, work.WithJitter(0)) })
+	b.Run("yield", func(b *testing.B) { benchmarkLatency(b, work.WithYield()) })
+}
+
+func BenchmarkRuntimeMax(b *testing.B) {
+	defer work.SetRuntimeMax(0)
+	for _, max := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprint(max), func(b *testing.B) {
+			work.SetRuntimeMax(max)
+			work.DoN(b.N, func(int) {
+				time.Sleep(10 * time.Microsecond)
+			}, nil, 8, work.WithRuntimeMax())
+		})
+	}
+}
+
+func BenchmarkPartition(b *testing.B) {
+	s := make([]float64, 1e6)
+	for i := range s {
+		s[i] = float64(i)
+	}
+	add := func(a, b float64) float64 { return a + b }
+	b.Run("reduce", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			work.Reduce(len(s), func(idx int) float64 { return s[idx] }, 0, add)
+		}
+	})
+	b.Run("combine", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			work.DoCombine(len(s), func(idx int) float64 { return s[idx] }, add, 0)
+		}
+	})
+	b.Run("partition", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			work.DoPartition(s, func(sub []float64) float64 {
+				var sum float64
+				for _, x := range sub {
+					sum += x
+				}
+				return sum
+			}, add)
+		}
+	})
+}
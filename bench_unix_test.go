@@ -0,0 +1,39 @@
+//go:build unix
+
+package work_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+// cpuTime returns the user and system CPU time consumed by the process so far.
+func cpuTime(b *testing.B) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// benchmarkFinalizer reports the CPU time spent by the process for n trivial workers and finalizer calls,
+// along with the wall time.
+func benchmarkFinalizer(b *testing.B, opts ...work.Option) {
+	const n = 1e6
+	start := cpuTime(b)
+	for i := 0; i < b.N; i++ {
+		work.Do(n, func(int) {}, func(int) {}, opts...)
+	}
+	b.ReportMetric(float64(cpuTime(b)-start)/float64(b.N), "cpu-ns/op")
+}
+
+func BenchmarkCoalescing(b *testing.B) {
+	// the implementation without options, which has no coalescing
+	b.Run("default", func(b *testing.B) { benchmarkFinalizer(b) })
+	// a no-op option selects the same implementation as WithCoalescing
+	b.Run("batch", func(b *testing.B) { benchmarkFinalizer(b, work.WithJitter(0)) })
+	b.Run("coalescing", func(b *testing.B) { benchmarkFinalizer(b, work.WithCoalescing()) })
+}
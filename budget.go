@@ -0,0 +1,40 @@
+package work
+
+import "sync"
+
+// DoMemoryBudget spawns workers with index 0 to n-1, limiting their numbers by max
+// and the sum of their costs by budget, e.g. the estimated memory needed to process their items.
+// Workers are dispatched in increasing index order, cost being called on an item right before its dispatch:
+// an item waits until enough of the budget is released by the running workers.
+// An item costing more than budget runs alone.
+func DoMemoryBudget(n int, cost func(idx int) int64, worker func(idx int), budget int64, max int) {
+	var (
+		mu       sync.Mutex
+		released = sync.NewCond(&mu)
+		inFlight int64 // sum of the costs of the running workers
+		sem      = make(chan struct{}, max)
+		wg       sync.WaitGroup
+	)
+	for idx := 0; idx < n; idx++ {
+		sem <- struct{}{}
+		c := cost(idx)
+		mu.Lock()
+		for inFlight > 0 && inFlight+c > budget {
+			released.Wait()
+		}
+		inFlight += c
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(idx int) {
+			worker(idx)
+			mu.Lock()
+			inFlight -= c
+			released.Broadcast()
+			mu.Unlock()
+			<-sem
+			wg.Done()
+		}(idx)
+	}
+	wg.Wait()
+}
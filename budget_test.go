@@ -0,0 +1,56 @@
+package work_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoMemoryBudget(t *testing.T) {
+	const budget = 10
+	for _, n := range indexes {
+		var (
+			mu       sync.Mutex
+			inFlight int64
+			running  int
+			results  = make([]int, n)
+		)
+		// every fifth item is over budget
+		cost := func(idx int) int64 {
+			if idx%5 == 4 {
+				return 2 * budget
+			}
+			return int64(idx%3 + 2)
+		}
+		worker := func(idx int) {
+			c := cost(idx)
+			mu.Lock()
+			inFlight += c
+			running++
+			if c > budget && running > 1 {
+				t.Errorf("over budget item %d not run alone", idx)
+			} else if c <= budget && inFlight > budget {
+				t.Errorf("budget exceeded: %d", inFlight)
+			}
+			mu.Unlock()
+
+			time.Sleep(100 * time.Microsecond)
+			results[idx] = 1
+
+			mu.Lock()
+			inFlight -= c
+			running--
+			mu.Unlock()
+		}
+		work.DoMemoryBudget(n, cost, worker, budget, 4)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		if t.Failed() {
+			t.FailNow()
+		}
+	}
+}
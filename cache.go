@@ -0,0 +1,29 @@
+package work
+
+// Cache stores the results of workers by key, e.g. an LRU cache.
+// It must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (any, bool)
+	Set(key string, v any)
+}
+
+// DoCached spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and returns their results, the result of the worker with index i being at position i.
+// The worker for index idx is only run if cache holds no result for keyOf(idx),
+// its result being then stored into cache, so that calls sharing cache do not compute the same result twice.
+// Workers for indexes with the same key running concurrently are not deduplicated.
+// DoCached panics if the cached value for a key is not of type R.
+func DoCached[R any](n int, keyOf func(idx int) string, cache Cache, worker func(idx int) R) []R {
+	res := make([]R, n)
+	Do(n, func(idx int) {
+		key := keyOf(idx)
+		if v, ok := cache.Get(key); ok {
+			res[idx] = v.(R)
+			return
+		}
+		r := worker(idx)
+		cache.Set(key, r)
+		res[idx] = r
+	}, nil)
+	return res
+}
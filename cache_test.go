@@ -0,0 +1,57 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+// mapCache is a Cache backed by a map.
+type mapCache struct {
+	mu sync.Mutex
+	m  map[string]any
+}
+
+func (c *mapCache) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[key]
+	return v, ok
+}
+
+func (c *mapCache) Set(key string, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = v
+}
+
+func TestDoCached(t *testing.T) {
+	for _, n := range indexes {
+		cache := &mapCache{m: make(map[string]any)}
+		var runs int32
+		keyOf := func(idx int) string {
+			return fmt.Sprint(idx)
+		}
+		worker := func(idx int) int {
+			atomic.AddInt32(&runs, 1)
+			return idx * 2
+		}
+		for call := 0; call < 2; call++ {
+			res := work.DoCached(n, keyOf, cache, worker)
+			for i, r := range res {
+				if r != i*2 {
+					t.Errorf("unexpected result for index %d: %d", i, r)
+					t.FailNow()
+				}
+			}
+		}
+		// the second call only uses the cache
+		if runs != int32(n) {
+			t.Errorf("unexpected worker runs: got %d expected %d", runs, n)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package work
+
+// DoChained spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and finalizes their items in two stages, each running on its own goroutine:
+// first1 is called on the processed items in increasing index order and its result is handed over to then2,
+// which is also called in increasing index order.
+// then2 is called on an item after first1 returned for it, possibly while first1 runs on the following items,
+// so that the two stages overlap. Up to GOMAXPROCS results of first1 can wait for then2.
+func DoChained[R any](n int, worker func(idx int), first1 func(idx int) R, then2 func(idx int, r R)) {
+	type result struct {
+		idx int
+		r   R
+	}
+	var (
+		resc  = make(chan result, numRoutines)
+		donec = make(chan struct{})
+	)
+	go func() {
+		for res := range resc {
+			then2(res.idx, res.r)
+		}
+		close(donec)
+	}()
+
+	Do(n, worker, func(idx int) {
+		resc <- result{idx, first1(idx)}
+	})
+	close(resc)
+	<-donec
+}
@@ -0,0 +1,49 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoChained(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu     sync.Mutex
+			stage1 = make(map[int]bool)
+			final  []string
+		)
+		results := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = idx + 1
+		}
+		first1 := func(idx int) string {
+			mu.Lock()
+			stage1[idx] = true
+			mu.Unlock()
+			return fmt.Sprint(results[idx])
+		}
+		then2 := func(idx int, r string) {
+			mu.Lock()
+			ok := stage1[idx]
+			mu.Unlock()
+			if !ok {
+				t.Errorf("second stage run before the first one for index %d", idx)
+			}
+			final = append(final, r)
+		}
+		work.DoChained(n, worker, first1, then2)
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: %v", final)
+			t.FailNow()
+		}
+		for i, r := range final {
+			if r != fmt.Sprint(i+1) {
+				t.Errorf("second stage ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package work
+
+import "time"
+
+// Clock is the source of time used by the package, as set by WithClock.
+// It lets tests control time, e.g. with worktest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel receiving the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a Timer sending the current time on its channel once d has elapsed.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc returns a Timer calling f in its own goroutine once d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event returned by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is sent, nil for a Timer returned by AfterFunc.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing and reports whether it did, false if it already fired.
+	Stop() bool
+}
+
+// realClock is the Clock of the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// realTimer is a Timer of the time package.
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
@@ -0,0 +1,23 @@
+package work
+
+import "context"
+
+// DoWithContext spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithError but each worker receives its own context, derived from ctx,
+// which is cancelled when processing is aborted.
+// The first error encountered aborts all processing and is then returned.
+// If ctx is cancelled before all items were processed, its error is returned.
+// The finalizer is then still called on the items whose worker completed, in order,
+// up to the first one that was not processed, before returning.
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+func DoWithContext(ctx context.Context, n int, worker func(ctx context.Context, idx int) error, finalizer func(idx int) error, opts ...Option) error {
+	return DoNWithContext(ctx, n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNWithContext spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithContext.
+func DoNWithContext(ctx context.Context, n int, worker func(ctx context.Context, idx int) error, finalizer func(idx int) error, max int, opts ...Option) error {
+	b := newBatch(ctx, n, worker, finalizer, max, opts)
+	b.run()
+	return b.err
+}
@@ -0,0 +1,161 @@
+package work_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithContext(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		final := make([]int, n)
+		worker := func(ctx context.Context, idx int) error {
+			results[idx] = 1
+			return nil
+		}
+		pos := 0
+		finalizer := func(idx int) error {
+			pos++
+			final[idx] = pos
+			return nil
+		}
+		err := work.DoWithContext(context.Background(), n, worker, finalizer)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i+1 {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoWithContextWorkerError(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		worker := func(ctx context.Context, idx int) error {
+			if idx == 1 {
+				return fmt.Errorf("fail")
+			}
+			// block until the batch is aborted
+			<-ctx.Done()
+			return nil
+		}
+		err := work.DoNWithContext(context.Background(), n, worker, nil, n)
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected worker error, got %v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithContextCancel(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		worker := func(ctx context.Context, idx int) error {
+			if idx == 0 {
+				cancel()
+			}
+			return nil
+		}
+		// the remaining workers are never started
+		err := work.DoNWithContext(ctx, n, worker, nil, 1)
+		if err != context.Canceled {
+			t.Errorf("expected context error, got %v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithContextCancelFinalizesPrefix(t *testing.T) {
+	const n = 8
+	var (
+		mu        sync.Mutex
+		completed = make([]bool, n)
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	worker := func(ctx context.Context, idx int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mu.Lock()
+		completed[idx] = true
+		mu.Unlock()
+		return nil
+	}
+	var final []int
+	// a slow finalizer lets results pile up before the cancellation
+	finalizer := func(idx int) error {
+		time.Sleep(time.Millisecond)
+		if idx == 1 {
+			cancel()
+		}
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoNWithContext(ctx, n, worker, finalizer, 2)
+	var prefix []int
+	for i, ok := range completed {
+		if !ok {
+			break
+		}
+		prefix = append(prefix, i)
+	}
+	if len(prefix) < n && err != context.Canceled {
+		t.Errorf("expected context error, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != fmt.Sprint(prefix) {
+		t.Errorf("unexpected finalized items: got %v expected %v", final, prefix)
+		t.FailNow()
+	}
+	if len(final) < 2 {
+		t.Errorf("expected the items finalized before the cancellation")
+		t.FailNow()
+	}
+}
+
+func TestWithWorkerContext(t *testing.T) {
+	type key struct{}
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		derive := func(parent context.Context, idx int) context.Context {
+			return context.WithValue(parent, key{}, idx)
+		}
+		worker := func(ctx context.Context, idx int) error {
+			if v, _ := ctx.Value(key{}).(int); v != idx {
+				return fmt.Errorf("unexpected value for index %d: %v", idx, ctx.Value(key{}))
+			}
+			if idx == 1 {
+				return fmt.Errorf("fail")
+			}
+			// the derived context is still cancelled when the batch is aborted
+			<-ctx.Done()
+			return nil
+		}
+		err := work.DoNWithContext(context.Background(), n, worker, nil, n, work.WithWorkerContext(derive))
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected worker error, got %v", err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package work
+
+import "context"
+
+// DoConverge spawns workers with index 0 to n-1, limiting their numbers by max,
+// until converged reports that the results obtained so far are good enough.
+// converged is called after each item is processed, in increasing index order, with the results
+// of all the items up to it, and never concurrently.
+// Once it returns true, no more workers are started and the results it was given are returned,
+// the ones of the workers still running being discarded. All the results are returned if it never does.
+// The results must not be modified by converged.
+func DoConverge[R any](n int, worker func(idx int) R, converged func(results []R) bool, max int) []R {
+	var (
+		results = make([]R, n)
+		count   int
+		done    bool
+		b       *Batch
+	)
+	b = newBatch(context.Background(), n, func(_ context.Context, idx int) error {
+		results[idx] = worker(idx)
+		return nil
+	}, func(idx int) error {
+		if done {
+			return nil
+		}
+		count = idx + 1
+		if converged(results[:count:count]) {
+			done = true
+			b.Cancel()
+		}
+		return nil
+	}, max, nil)
+	b.run()
+	return results[:count:count]
+}
@@ -0,0 +1,41 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoConverge(t *testing.T) {
+	for _, n := range indexes {
+		var calls int
+		worker := func(idx int) int {
+			return idx
+		}
+		// stop once the sum reaches 100
+		converged := func(results []int) bool {
+			calls++
+			if len(results) != calls {
+				t.Errorf("unexpected results size: got %d expected %d", len(results), calls)
+			}
+			var sum int
+			for i, r := range results {
+				if r != i {
+					t.Errorf("unexpected result %d at index %d", r, i)
+				}
+				sum += r
+			}
+			return sum >= 100
+		}
+		res := work.DoConverge(n, worker, converged, 4)
+		expected := n
+		if n > 15 {
+			// 0+1+...+14 = 105
+			expected = 15
+		}
+		if len(res) != expected {
+			t.Errorf("unexpected results size: got %d expected %d", len(res), expected)
+			t.FailNow()
+		}
+	}
+}
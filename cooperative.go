@@ -0,0 +1,22 @@
+package work
+
+import "context"
+
+// DoWithShouldStop spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithError but each worker receives a shouldStop function reporting true
+// once processing is being aborted, by an error of another item, so that long running workers
+// can poll it and bail out early without using a context.
+// The error returned by a worker that bailed out is ignored in favor of the one that caused the abort.
+func DoWithShouldStop(n int, worker func(idx int, shouldStop func() bool) error, finalizer func(idx int) error, opts ...Option) error {
+	return DoNWithShouldStop(n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNWithShouldStop spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithShouldStop.
+func DoNWithShouldStop(n int, worker func(idx int, shouldStop func() bool) error, finalizer func(idx int) error, max int, opts ...Option) error {
+	return DoNWithContext(context.Background(), n, func(ctx context.Context, idx int) error {
+		return worker(idx, func() bool {
+			return ctx.Err() != nil
+		})
+	}, finalizer, max, opts...)
+}
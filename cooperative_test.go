@@ -0,0 +1,57 @@
+package work_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithShouldStop(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int, shouldStop func() bool) error {
+			if shouldStop() {
+				return fmt.Errorf("stopped")
+			}
+			results[idx] = 1
+			return nil
+		}
+		err := work.DoWithShouldStop(n, worker, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithShouldStopAbort(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		worker := func(idx int, shouldStop func() bool) error {
+			if idx == 1 {
+				return fmt.Errorf("fail")
+			}
+			// poll until the batch is aborted
+			for deadline := time.Now().Add(5 * time.Second); !shouldStop(); {
+				if time.Now().After(deadline) {
+					return fmt.Errorf("not stopped")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return fmt.Errorf("stopped")
+		}
+		err := work.DoNWithShouldStop(n, worker, nil, n)
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected worker error, got %v", err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package work
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CycleError is returned by DoDAG when the dependencies of the items form a cycle.
+type CycleError struct {
+	// Indexes holds the items of the cycle, each one depending on the next and the last on the first.
+	Indexes []int
+}
+
+func (e *CycleError) Error() string {
+	s := make([]string, len(e.Indexes))
+	for i, idx := range e.Indexes {
+		s[i] = fmt.Sprint(idx)
+	}
+	return fmt.Sprintf("work: dependency cycle: %s -> %d", strings.Join(s, " -> "), e.Indexes[0])
+}
+
+// DoDAG spawns workers with index 0 to n-1, limiting their numbers by max,
+// each one only once the workers of all the indexes returned by deps for it have succeeded.
+// The dependencies are checked before any worker runs: if they form a cycle, a *CycleError is returned.
+// The first error encountered stops the dispatch of new workers and is returned once the running ones are done.
+// DoDAG panics if deps returns an invalid index.
+// If max is not positive, it defaults to GOMAXPROCS.
+func DoDAG(n int, deps func(idx int) []int, worker func(idx int) error, max int) error {
+	if max <= 0 {
+		max = numRoutines
+	}
+	var (
+		dependents = make([][]int, n) // items depending on each item
+		blockers   = make([][]int, n) // items each item depends on
+		pending    = make([]int, n)   // number of dependencies not done yet
+	)
+	for idx := 0; idx < n; idx++ {
+		for _, d := range deps(idx) {
+			if d < 0 || d >= n {
+				panic(fmt.Sprintf("work: invalid dependency %d for index %d", d, idx))
+			}
+			dependents[d] = append(dependents[d], idx)
+			blockers[idx] = append(blockers[idx], d)
+			pending[idx]++
+		}
+	}
+	if cycle := findCycle(dependents, blockers, pending); cycle != nil {
+		return &CycleError{Indexes: cycle}
+	}
+
+	type result struct {
+		idx int
+		err error
+	}
+	var (
+		ready   []int
+		resc    = make(chan result)
+		running int
+		err     error
+	)
+	for idx, p := range pending {
+		if p == 0 {
+			ready = append(ready, idx)
+		}
+	}
+	for {
+		for ; len(ready) > 0 && running < max && err == nil; running++ {
+			go func(idx int) {
+				resc <- result{idx, worker(idx)}
+			}(ready[0])
+			ready = ready[1:]
+		}
+		if running == 0 {
+			return err
+		}
+		res := <-resc
+		running--
+		if res.err != nil {
+			if err == nil {
+				err = res.err
+			}
+			continue
+		}
+		for _, idx := range dependents[res.idx] {
+			if pending[idx]--; pending[idx] == 0 {
+				ready = append(ready, idx)
+			}
+		}
+	}
+}
+
+// findCycle returns the items of a dependency cycle, nil if there is none.
+func findCycle(dependents, blockers [][]int, pending []int) []int {
+	left := make([]int, len(pending))
+	copy(left, pending)
+	var queue []int
+	for idx, p := range left {
+		if p == 0 {
+			queue = append(queue, idx)
+		}
+	}
+	for len(queue) > 0 {
+		idx := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[idx] {
+			if left[d]--; left[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+	// every remaining item depends on at least one other remaining item:
+	// following these dependencies eventually loops
+	for idx, p := range left {
+		if p == 0 {
+			continue
+		}
+		seen := make(map[int]int) // position of each item in path
+		var path []int
+		for {
+			if pos, ok := seen[idx]; ok {
+				return path[pos:]
+			}
+			seen[idx] = len(path)
+			path = append(path, idx)
+			for _, d := range blockers[idx] {
+				if left[d] > 0 {
+					idx = d
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
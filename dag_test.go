@@ -0,0 +1,138 @@
+package work_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoDAG(t *testing.T) {
+	for _, n := range indexes {
+		// every item depends on its half and its predecessor
+		deps := func(idx int) []int {
+			if idx == 0 {
+				return nil
+			}
+			return []int{idx / 2, idx - 1}
+		}
+		var (
+			mu   sync.Mutex
+			done = make([]bool, n)
+		)
+		worker := func(idx int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, d := range deps(idx) {
+				if !done[d] {
+					return fmt.Errorf("index %d run before its dependency %d", idx, d)
+				}
+			}
+			done[idx] = true
+			return nil
+		}
+		if err := work.DoDAG(n, deps, worker, 4); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		for idx, ok := range done {
+			if !ok {
+				t.Errorf("index %d not processed", idx)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoDAGError(t *testing.T) {
+	// 0 <- 1 <- 2 and 3 independent
+	deps := func(idx int) []int {
+		if idx == 1 || idx == 2 {
+			return []int{idx - 1}
+		}
+		return nil
+	}
+	var (
+		mu  sync.Mutex
+		ran = make(map[int]bool)
+	)
+	worker := func(idx int) error {
+		mu.Lock()
+		ran[idx] = true
+		mu.Unlock()
+		if idx == 1 {
+			return fmt.Errorf("fail")
+		}
+		return nil
+	}
+	err := work.DoDAG(4, deps, worker, 1)
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected worker error, got %v", err)
+		t.FailNow()
+	}
+	if ran[2] {
+		t.Errorf("index 2 run after its dependency failed")
+		t.FailNow()
+	}
+}
+
+func TestDoDAGCycle(t *testing.T) {
+	// 0 is independent, 1 -> 2 -> 3 -> 1 and 4 depends on the cycle
+	deps := func(idx int) []int {
+		switch idx {
+		case 1:
+			return []int{2}
+		case 2:
+			return []int{3}
+		case 3:
+			return []int{1, 0}
+		case 4:
+			return []int{3}
+		}
+		return nil
+	}
+	worker := func(idx int) error {
+		t.Errorf("index %d run despite the cycle", idx)
+		return nil
+	}
+	err := work.DoDAG(5, deps, worker, 2)
+	var ce *work.CycleError
+	if !errors.As(err, &ce) {
+		t.Errorf("expected cycle error, got %v", err)
+		t.FailNow()
+	}
+	cycle := make(map[int]bool)
+	for _, idx := range ce.Indexes {
+		cycle[idx] = true
+	}
+	if len(ce.Indexes) != 3 || !cycle[1] || !cycle[2] || !cycle[3] {
+		t.Errorf("unexpected cycle: %v", ce.Indexes)
+		t.FailNow()
+	}
+}
+
+func TestDoDAGNoMax(t *testing.T) {
+	const n = 8
+	results := make([]int, n)
+	// each item depends on the previous one
+	deps := func(idx int) []int {
+		if idx == 0 {
+			return nil
+		}
+		return []int{idx - 1}
+	}
+	err := work.DoDAG(n, deps, func(idx int) error {
+		results[idx] = 1
+		return nil
+	}, 0)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if m := count(results); m != n {
+		t.Errorf("unexpected results size: got %d expected %d", m, n)
+		t.FailNow()
+	}
+}
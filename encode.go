@@ -0,0 +1,26 @@
+package work
+
+// Encoder is implemented by the encoders of the standard library, such as json.Encoder and gob.Encoder.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// DoEncode spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and encodes their results with enc in increasing index order, from a single goroutine
+// so that enc needs no locking.
+// The first encoding error aborts all processing and is then returned as an IndexError.
+func DoEncode[R any](n int, worker func(idx int) R, enc Encoder) error {
+	res := make([]R, n)
+	return DoWithError(n, func(idx int) error {
+		res[idx] = worker(idx)
+		return nil
+	}, func(idx int) error {
+		r := res[idx]
+		var zero R
+		res[idx] = zero
+		if err := enc.Encode(r); err != nil {
+			return IndexError{idx, err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package work_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoEncode(t *testing.T) {
+	for _, n := range indexes {
+		var buf bytes.Buffer
+		err := work.DoEncode(n, func(idx int) map[string]int {
+			return map[string]int{"idx": idx}
+		}, json.NewEncoder(&buf))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		dec := json.NewDecoder(&buf)
+		for i := 0; i < n; i++ {
+			var v map[string]int
+			if err := dec.Decode(&v); err != nil {
+				t.Errorf("unexpected decoding error: %v", err)
+				t.FailNow()
+			}
+			if v["idx"] != i {
+				t.Errorf("unexpected result at position %d: %v", i, v)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+type failingEncoder struct {
+	n int
+}
+
+func (e *failingEncoder) Encode(v any) error {
+	if e.n == 2 {
+		return fmt.Errorf("fail")
+	}
+	e.n++
+	return nil
+}
+
+func TestDoEncodeError(t *testing.T) {
+	err := work.DoEncode(8, func(idx int) int { return idx }, &failingEncoder{})
+	var ie work.IndexError
+	if !errors.As(err, &ie) || ie.Index != 2 || ie.Err.Error() != "fail" {
+		t.Errorf("expected encoding error at index 2, got %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,104 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrFinalizerTimeout is returned when a call to the finalizer lasts longer than allowed by WithFinalizerTimeout.
+var ErrFinalizerTimeout = errors.New("work: finalizer timed out")
+
+// ErrOutOfOrder is returned when WithOrderCheck detects an item finalized out of order.
+var ErrOutOfOrder = errors.New("work: item finalized out of order")
+
+// IndexError records the error returned by the worker for the item with index Index.
+type IndexError struct {
+	Index int
+	Err   error
+}
+
+func (e IndexError) Error() string {
+	return fmt.Sprintf("work: index %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the worker error.
+func (e IndexError) Unwrap() error {
+	return e.Err
+}
+
+// joinIndexErrors combines errs, sorted by index, into a single error.
+func joinIndexErrors(errs []IndexError) error {
+	sorted := make([]error, len(errs))
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Index < errs[j].Index
+	})
+	for i, err := range errs {
+		sorted[i] = err
+	}
+	return errors.Join(sorted...)
+}
+
+// DoOrderedErrors spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Unlike DoWithError, all workers are run regardless of failures.
+// The returned slice has length n and holds the error returned by the worker with index i at position i,
+// nil if it succeeded.
+func DoOrderedErrors(n int, worker func(idx int) error) []error {
+	return DoNOrderedErrors(n, worker, numRoutines)
+}
+
+// DoNOrderedErrors spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoOrderedErrors.
+func DoNOrderedErrors(n int, worker func(idx int) error, max int) []error {
+	errs := make([]error, n)
+	do(n, func(idx int) {
+		errs[idx] = worker(idx)
+	}, max)
+	return errs
+}
+
+// DoStreamErrors spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Like DoOrderedErrors, all workers are run regardless of failures, but their errors are sent to errs
+// as soon as they occur, in no particular order. errs is closed once all workers are done.
+// A failed worker blocks until its error is received, holding back the dispatch of the next ones:
+// the caller must drain errs, from another goroutine, or give it enough buffering.
+func DoStreamErrors(n int, worker func(idx int) error, errs chan<- IndexError) {
+	DoNStreamErrors(n, worker, errs, numRoutines)
+}
+
+// DoNStreamErrors spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoStreamErrors.
+func DoNStreamErrors(n int, worker func(idx int) error, errs chan<- IndexError, max int) {
+	defer close(errs)
+	do(n, func(idx int) {
+		if err := worker(idx); err != nil {
+			errs <- IndexError{idx, err}
+		}
+	}, max)
+}
+
+// DoErrorsByCategory spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Like DoOrderedErrors, all workers are run regardless of failures.
+// The errors are then grouped by the category returned by classify, called from the calling goroutine,
+// and the indexes of the failed items are returned by category, in increasing order.
+// It returns nil if all workers succeeded.
+func DoErrorsByCategory(n int, worker func(idx int) error, classify func(error) string) map[string][]int {
+	return DoNErrorsByCategory(n, worker, classify, numRoutines)
+}
+
+// DoNErrorsByCategory spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoErrorsByCategory.
+func DoNErrorsByCategory(n int, worker func(idx int) error, classify func(error) string, max int) map[string][]int {
+	var categories map[string][]int
+	for idx, err := range DoNOrderedErrors(n, worker, max) {
+		if err == nil {
+			continue
+		}
+		if categories == nil {
+			categories = make(map[string][]int)
+		}
+		c := classify(err)
+		categories[c] = append(categories[c], idx)
+	}
+	return categories
+}
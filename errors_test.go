@@ -0,0 +1,134 @@
+package work_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoOrderedErrors(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) error {
+			if idx%2 > 0 {
+				return fmt.Errorf("fail %d", idx)
+			}
+			return nil
+		}
+		errs := work.DoOrderedErrors(n, worker)
+		if len(errs) != n {
+			t.Errorf("unexpected errors size: got %d expected %d", len(errs), n)
+			t.FailNow()
+		}
+		for i, err := range errs {
+			if i%2 == 0 {
+				if err != nil {
+					t.Errorf("unexpected error at index %d: %v", i, err)
+					t.FailNow()
+				}
+				continue
+			}
+			if err == nil || err.Error() != fmt.Sprintf("fail %d", i) {
+				t.Errorf("unexpected error at index %d: %v", i, err)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoOrderedErrorsWithoutError(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) error {
+			results[idx] = 1
+			return nil
+		}
+		errs := work.DoOrderedErrors(n, worker)
+		if len(errs) != n {
+			t.Errorf("unexpected errors size: got %d expected %d", len(errs), n)
+			t.FailNow()
+		}
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("unexpected error at index %d: %v", i, err)
+				t.FailNow()
+			}
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoStreamErrors(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) error {
+			results[idx] = 1
+			if idx%2 > 0 {
+				return fmt.Errorf("fail %d", idx)
+			}
+			return nil
+		}
+		errs := make(chan work.IndexError)
+		go work.DoStreamErrors(n, worker, errs)
+		failed := make(map[int]bool)
+		for err := range errs {
+			if err.Err.Error() != fmt.Sprintf("fail %d", err.Index) {
+				t.Errorf("unexpected error: %v", err)
+				t.FailNow()
+			}
+			failed[err.Index] = true
+		}
+		if len(failed) != n/2 {
+			t.Errorf("unexpected number of errors: got %d expected %d", len(failed), n/2)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoErrorsByCategory(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	errAuth := errors.New("auth")
+	for _, n := range indexes {
+		worker := func(idx int) error {
+			switch idx % 3 {
+			case 1:
+				return fmt.Errorf("fail %d: %w", idx, errTimeout)
+			case 2:
+				return fmt.Errorf("fail %d: %w", idx, errAuth)
+			}
+			return nil
+		}
+		classify := func(err error) string {
+			if errors.Is(err, errTimeout) {
+				return "timeout"
+			}
+			return "auth"
+		}
+		categories := work.DoErrorsByCategory(n, worker, classify)
+		var timeouts, auths []int
+		for idx := 0; idx < n; idx++ {
+			switch idx % 3 {
+			case 1:
+				timeouts = append(timeouts, idx)
+			case 2:
+				auths = append(auths, idx)
+			}
+		}
+		if fmt.Sprint(categories["timeout"]) != fmt.Sprint(timeouts) || fmt.Sprint(categories["auth"]) != fmt.Sprint(auths) {
+			t.Errorf("unexpected categories: %v", categories)
+			t.FailNow()
+		}
+		if n < 2 && categories != nil {
+			t.Errorf("expected no categories, got %v", categories)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package work
+
+// fanOut returns a finalizer calling finalizer, if set, and handing the items over to the finalizers
+// set by WithFinalizers, each running on its own goroutine until fanOutDone is called.
+func (b *Batch) fanOut(finalizer func(idx int) error) func(idx int) error {
+	b.fanc = make([]chan int, len(b.finalizers))
+	for i, f := range b.finalizers {
+		c := make(chan int, b.max)
+		b.fanc[i] = c
+		b.fanwg.Add(1)
+		go func() {
+			defer b.fanwg.Done()
+			for idx := range c {
+				if b.failed.Load() && !b.alwaysFinalize {
+					// keep draining c to not block the finalizer
+					continue
+				}
+				if err := f(idx); err != nil {
+					b.abort(CauseFinalizer, err)
+				}
+			}
+		}()
+	}
+	return func(idx int) error {
+		if finalizer != nil {
+			if err := finalizer(idx); err != nil {
+				return err
+			}
+		}
+		for _, c := range b.fanc {
+			c <- idx
+		}
+		return nil
+	}
+}
+
+// fanOutDone waits for the finalizers set by WithFinalizers to be done with the items handed over to them.
+func (b *Batch) fanOutDone() {
+	for _, c := range b.fanc {
+		close(c)
+	}
+	b.fanwg.Wait()
+}
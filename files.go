@@ -0,0 +1,56 @@
+package work
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileError records the error returned by the worker for the file at Path.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("work: %s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the worker error.
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// DoFiles spawns a worker for each regular file in dir whose name matches, limiting their numbers by max.
+// Subdirectories are not walked and a nil match selects all files.
+// Workers receive the path of their file, made of dir and the file name.
+// The first error encountered aborts all processing and is then returned as a FileError.
+// An error listing dir is returned as is.
+// If finalizer is set, then it is called on the processed files, sorted by name.
+func DoFiles(dir string, match func(name string) bool, worker func(path string) error, finalizer func(path string), max int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || match != nil && !match(e.Name()) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+
+	var fn func(idx int) error
+	if finalizer != nil {
+		fn = func(idx int) error {
+			finalizer(paths[idx])
+			return nil
+		}
+	}
+	return DoNWithError(len(paths), func(idx int) error {
+		if err := worker(paths[idx]); err != nil {
+			return FileError{paths[idx], err}
+		}
+		return nil
+	}, fn, max)
+}
@@ -0,0 +1,74 @@
+package work_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("file%02d.txt", i))
+		if err := os.WriteFile(name, []byte(fmt.Sprint(i)), 0o644); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "skip.log"), nil, 0o644); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.txt"), 0o755); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	match := func(name string) bool {
+		return strings.HasSuffix(name, ".txt")
+	}
+
+	var out []string
+	err := work.DoFiles(dir, match, func(path string) error {
+		_, err := os.ReadFile(path)
+		return err
+	}, func(path string) {
+		out = append(out, filepath.Base(path))
+	}, 4)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if len(out) != 20 {
+		t.Errorf("unexpected processed files: %v", out)
+		t.FailNow()
+	}
+	for i, name := range out {
+		if name != fmt.Sprintf("file%02d.txt", i) {
+			t.Errorf("finalizer ran out of order: %v", out)
+			t.FailNow()
+		}
+	}
+
+	errFail := errors.New("fail")
+	err = work.DoFiles(dir, match, func(path string) error {
+		if filepath.Base(path) == "file05.txt" {
+			return errFail
+		}
+		return nil
+	}, nil, 4)
+	var fe work.FileError
+	if !errors.As(err, &fe) || fe.Path != filepath.Join(dir, "file05.txt") || !errors.Is(err, errFail) {
+		t.Errorf("expected the error of file05.txt, got %v", err)
+		t.FailNow()
+	}
+
+	if err := work.DoFiles(filepath.Join(dir, "missing"), nil, func(string) error { return nil }, nil, 4); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing directory error, got %v", err)
+		t.FailNow()
+	}
+}
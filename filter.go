@@ -0,0 +1,27 @@
+package work
+
+// DoFinalizeIf spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and calls finalizer, in increasing index order, only on the results for which cond returns true.
+// cond is called by the worker goroutines, possibly concurrently, right after the worker returns.
+// Results not meeting cond are dropped as soon as possible and do not hold back the following ones
+// any longer than their worker runs.
+// There is no option for it since options cannot see the results of the workers.
+func DoFinalizeIf[R any](n int, worker func(idx int) R, cond func(idx int, r R) bool, finalizer func(idx int, r R)) {
+	type result struct {
+		r    R
+		keep bool
+	}
+	results := make([]result, n)
+	Do(n, func(idx int) {
+		r := worker(idx)
+		if cond(idx, r) {
+			results[idx] = result{r, true}
+		}
+	}, func(idx int) {
+		if res := results[idx]; res.keep {
+			finalizer(idx, res.r)
+		}
+		// release the result as soon as possible
+		results[idx] = result{}
+	})
+}
@@ -0,0 +1,34 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoFinalizeIf(t *testing.T) {
+	for _, n := range indexes {
+		var final []int
+		work.DoFinalizeIf(n, func(idx int) float64 {
+			return float64(idx) / 2
+		}, func(idx int, v float64) bool {
+			// only whole values qualify
+			return v == float64(int(v))
+		}, func(idx int, v float64) {
+			if v != float64(idx)/2 {
+				t.Errorf("unexpected value for index %d: %v", idx, v)
+			}
+			final = append(final, idx)
+		})
+		if len(final) != (n+1)/2 {
+			t.Errorf("unexpected finalized items: %v", final)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			if idx != 2*i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package work
+
+import (
+	"context"
+	"sync"
+)
+
+// DoFirst spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// until one of them reports a success.
+// It returns the result and index of the first successful worker, the remaining workers not being dispatched.
+// Worker errors do not stop processing: if no worker succeeds, the zero value and an index of -1 are returned
+// along with the combined IndexError of all failures, sorted by index, or nil if none failed.
+func DoFirst[R any](n int, worker func(idx int) (R, bool, error)) (R, int, error) {
+	var (
+		mu    sync.Mutex
+		res   R
+		index = -1
+		errs  []IndexError
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := newBatch(ctx, n, func(ctx context.Context, idx int) error {
+		r, ok, err := worker(idx)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			errs = append(errs, IndexError{idx, err})
+		case ok && index < 0:
+			res, index = r, idx
+			cancel()
+		}
+		return nil
+	}, nil, numRoutines, nil)
+	b.run()
+
+	if index >= 0 || len(errs) == 0 {
+		return res, index, nil
+	}
+	return res, index, joinIndexErrors(errs)
+}
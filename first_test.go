@@ -0,0 +1,57 @@
+package work_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoFirst(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		good := n - 1
+		worker := func(idx int) (string, bool, error) {
+			switch {
+			case idx == good:
+				return "good", true, nil
+			case idx%2 > 0:
+				return "", false, fmt.Errorf("fail")
+			}
+			return "bad", false, nil
+		}
+		r, idx, err := work.DoFirst(n, worker)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if r != "good" || idx != good {
+			t.Errorf("unexpected result: got %q at %d", r, idx)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoFirstNone(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		worker := func(idx int) (int, bool, error) {
+			return idx, false, fmt.Errorf("fail %d", idx)
+		}
+		r, idx, err := work.DoFirst(n, worker)
+		var ierr work.IndexError
+		if !errors.As(err, &ierr) {
+			t.Errorf("expected index error, got %v", err)
+			t.FailNow()
+		}
+		if r != 0 || idx != -1 {
+			t.Errorf("unexpected result: got %d at %d", r, idx)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package work
+
+// DoFuncs runs funcs concurrently, limiting their numbers by max.
+// If finalizer is set, then it is called with the index of each completed function, in increasing index order.
+func DoFuncs(funcs []func(), finalizer func(idx int), max int) {
+	DoN(len(funcs), func(idx int) {
+		funcs[idx]()
+	}, finalizer, max)
+}
+
+// DoFuncsWithError runs funcs concurrently, limiting their numbers by max.
+// Similar to DoFuncs but with error handling.
+// The first error encountered aborts all processing and is then returned.
+func DoFuncsWithError(funcs []func() error, finalizer func(idx int) error, max int) error {
+	return DoNWithError(len(funcs), func(idx int) error {
+		return funcs[idx]()
+	}, finalizer, max)
+}
@@ -0,0 +1,45 @@
+package work_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoFuncs(t *testing.T) {
+	var a, b string
+	var c int
+	funcs := []func(){
+		func() { a = "a" },
+		func() { b = "b" },
+		func() { c = 3 },
+	}
+	var final []int
+	work.DoFuncs(funcs, func(idx int) {
+		final = append(final, idx)
+	}, 2)
+	if a != "a" || b != "b" || c != 3 {
+		t.Errorf("functions not run: %q %q %d", a, b, c)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 1 2]" {
+		t.Errorf("finalizer ran out of order: %v", final)
+		t.FailNow()
+	}
+}
+
+func TestDoFuncsWithError(t *testing.T) {
+	funcs := []func() error{
+		func() error { return nil },
+		func() error { return fmt.Errorf("fail") },
+	}
+	if err := work.DoFuncsWithError(funcs, nil, 2); err == nil {
+		t.Errorf("expected error")
+		t.FailNow()
+	}
+	if err := work.DoFuncsWithError(funcs[:1], nil, 2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+}
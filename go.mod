@@ -0,0 +1,3 @@
+module github.com/pierrec/go-work
+
+go 1.23
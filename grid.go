@@ -0,0 +1,25 @@
+package work
+
+// Do2D spawns workers for every cell (r, c) of a grid of rows by cols cells, limiting their numbers by GOMAXPROCS.
+// Cells are dispatched in row-major order: all the cells of row 0 from column 0 to cols-1, then row 1 and so on.
+// If finalizer is set, then it is called on the processed cells in the same row-major order.
+func Do2D(rows, cols int, worker, finalizer func(r, c int)) {
+	DoN2D(rows, cols, worker, finalizer, numRoutines)
+}
+
+// DoN2D spawns workers for every cell of a grid of rows by cols cells, limiting their numbers by max.
+// Similar to Do2D.
+func DoN2D(rows, cols int, worker, finalizer func(r, c int), max int) {
+	if rows <= 0 || cols <= 0 {
+		return
+	}
+	var fn func(int)
+	if finalizer != nil {
+		fn = func(idx int) {
+			finalizer(idx/cols, idx%cols)
+		}
+	}
+	DoN(rows*cols, func(idx int) {
+		worker(idx/cols, idx%cols)
+	}, fn, max)
+}
@@ -0,0 +1,41 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDo2D(t *testing.T) {
+	for _, rows := range indexes {
+		const cols = 3
+		grid := make([][cols]int, rows)
+		worker := func(r, c int) {
+			grid[r][c]++
+		}
+		type cell struct{ r, c int }
+		var final []cell
+		finalizer := func(r, c int) {
+			final = append(final, cell{r, c})
+		}
+		work.Do2D(rows, cols, worker, finalizer)
+		for r := range grid {
+			for c, v := range grid[r] {
+				if v != 1 {
+					t.Errorf("cell (%d, %d) processed %d times", r, c, v)
+					t.FailNow()
+				}
+			}
+		}
+		if len(final) != rows*cols {
+			t.Errorf("unexpected finalized cells: got %d expected %d", len(final), rows*cols)
+			t.FailNow()
+		}
+		for i, f := range final {
+			if f.r != i/cols || f.c != i%cols {
+				t.Errorf("finalizer ran out of row-major order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package work
+
+import "sync"
+
+// Group runs functions in their own goroutine.
+// It is implemented by errgroup.Group from golang.org/x/sync/errgroup.
+type Group interface {
+	Go(f func() error)
+}
+
+// DoInGroup submits workers with index 0 to n-1 to g, which decides on their concurrency
+// (e.g. errgroup.Group.SetLimit).
+// Worker errors are returned to g as well as by DoInGroup.
+// The first error encountered aborts the submission and the processing of the pending items
+// and is then returned once all submitted workers are done.
+// If finalizer is set, then it is called on the processed items, in increasing index order,
+// from the calling goroutine.
+func DoInGroup(g Group, n int, worker, finalizer func(idx int) error) error {
+	var (
+		mu    sync.Mutex
+		err   error                   // first error encountered
+		workc = make(chan completion) // results from workers
+		wg    sync.WaitGroup
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return err != nil
+	}
+	fail := func(e error) {
+		mu.Lock()
+		if err == nil {
+			err = e
+		}
+		mu.Unlock()
+	}
+
+	// submit the workers from a separate goroutine as g may block
+	go func() {
+		for i := 0; i < n && !failed(); i++ {
+			idx := i
+			wg.Add(1)
+			g.Go(func() error {
+				defer wg.Done()
+				if failed() {
+					workc <- completion{idx: idx}
+					return nil
+				}
+				werr := worker(idx)
+				if werr != nil {
+					fail(werr)
+				}
+				workc <- completion{idx: idx, ok: werr == nil}
+				return werr
+			})
+		}
+		wg.Wait()
+		close(workc)
+	}()
+
+	// buffer holds results that cannot be finalized yet.
+	buffer := make(map[int]bool)
+	pos := 0
+	for c := range workc {
+		if finalizer == nil {
+			continue
+		}
+		buffer[c.idx] = c.ok
+		for ; !failed(); pos++ {
+			ok, found := buffer[pos]
+			if !found || !ok {
+				break
+			}
+			delete(buffer, pos)
+			if ferr := finalizer(pos); ferr != nil {
+				fail(ferr)
+			}
+		}
+	}
+
+	return err
+}
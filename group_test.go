@@ -0,0 +1,118 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+// limitGroup mimics errgroup.Group with a limit.
+type limitGroup struct {
+	wg      sync.WaitGroup
+	sem     chan struct{}
+	errOnce sync.Once
+	err     error
+	running int32
+	peak    int32
+}
+
+func newLimitGroup(limit int) *limitGroup {
+	return &limitGroup{sem: make(chan struct{}, limit)}
+}
+
+func (g *limitGroup) Go(f func() error) {
+	g.sem <- struct{}{}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			<-g.sem
+			g.wg.Done()
+		}()
+		r := atomic.AddInt32(&g.running, 1)
+		for p := atomic.LoadInt32(&g.peak); r > p; p = atomic.LoadInt32(&g.peak) {
+			if atomic.CompareAndSwapInt32(&g.peak, p, r) {
+				break
+			}
+		}
+		err := f()
+		atomic.AddInt32(&g.running, -1)
+		if err != nil {
+			g.errOnce.Do(func() { g.err = err })
+		}
+	}()
+}
+
+func (g *limitGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+func TestDoInGroup(t *testing.T) {
+	for _, n := range indexes {
+		g := newLimitGroup(2)
+		results := make([]int, n)
+		worker := func(idx int) error {
+			results[idx] = 1
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		if err := work.DoInGroup(g, n, worker, finalizer); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if err := g.Wait(); err != nil {
+			t.Errorf("unexpected group error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+		if g.peak > 2 {
+			t.Errorf("group limit exceeded: %d", g.peak)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoInGroupWithError(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		g := newLimitGroup(2)
+		worker := func(idx int) error {
+			if idx == 1 {
+				return fmt.Errorf("fail")
+			}
+			return nil
+		}
+		finalizer := func(idx int) error {
+			if idx > 0 {
+				t.Errorf("unexpected finalized index %d", idx)
+			}
+			return nil
+		}
+		if err := work.DoInGroup(g, n, worker, finalizer); err == nil {
+			t.Errorf("expected error")
+			t.FailNow()
+		}
+		if err := g.Wait(); err == nil {
+			t.Errorf("expected group error")
+			t.FailNow()
+		}
+	}
+}
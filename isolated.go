@@ -0,0 +1,14 @@
+package work
+
+// DoIsolated spawns workers with index 0 to n-1, running at most cpus of them at the same time
+// and yielding the processor after each one, so that a background batch leaves CPU time
+// to the rest of the program.
+// The isolation is soft: Go cannot restrict goroutines to a subset of its processors,
+// so workers may run on any of them and a running worker is only preempted by the Go scheduler.
+// It only bounds the number of processors the batch keeps busy at any time.
+func DoIsolated(n int, worker func(idx int), cpus int) {
+	if cpus < 1 {
+		cpus = 1
+	}
+	doYield(n, worker, cpus)
+}
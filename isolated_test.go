@@ -0,0 +1,36 @@
+package work_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoIsolated(t *testing.T) {
+	const cpus = 2
+	for _, n := range indexes {
+		var running, peak int32
+		results := make([]int, n)
+		work.DoIsolated(n, func(idx int) {
+			r := atomic.AddInt32(&running, 1)
+			for p := atomic.LoadInt32(&peak); r > p; p = atomic.LoadInt32(&peak) {
+				if atomic.CompareAndSwapInt32(&peak, p, r) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Microsecond)
+			results[idx] = 1
+			atomic.AddInt32(&running, -1)
+		}, cpus)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		if peak > cpus {
+			t.Errorf("too many workers: got %d expected at most %d", peak, cpus)
+			t.FailNow()
+		}
+	}
+}
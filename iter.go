@@ -0,0 +1,80 @@
+package work
+
+import (
+	"context"
+	"iter"
+)
+
+// Completed returns an iterator over the results of workers with index 0 to n-1,
+// limiting their numbers by GOMAXPROCS, yielding the index and result of each worker in completion order.
+// Workers are started when the iteration starts and results are consumed from a single goroutine.
+// Stopping the iteration early stops the dispatch of the remaining workers
+// and waits for the running ones to return.
+func Completed[R any](n int, worker func(idx int) R) iter.Seq2[int, R] {
+	return func(yield func(int, R) bool) {
+		type result struct {
+			idx int
+			r   R
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		resc := make(chan result)
+		b := StartN(ctx, n, func(ctx context.Context, idx int) error {
+			r := worker(idx)
+			select {
+			case resc <- result{idx, r}:
+			case <-ctx.Done():
+			}
+			return nil
+		}, nil, numRoutines)
+		go func() {
+			b.Wait()
+			close(resc)
+		}()
+
+		for res := range resc {
+			if !yield(res.idx, res.r) {
+				cancel()
+				// wait for the running workers
+				for range resc {
+				}
+				return
+			}
+		}
+	}
+}
+
+// Lazy returns an iterator over the results of workers with index 0 to n-1,
+// yielding the index and result of each worker in increasing index order.
+// Workers are only started as the results are consumed: up to max workers run ahead of the consumer,
+// the worker for the index being consumed included. Stopping the iteration early waits for the running
+// workers to return, the workers of the following indexes never being run.
+func Lazy[R any](n int, worker func(idx int) R, max int) iter.Seq2[int, R] {
+	if max < 1 {
+		max = 1
+	}
+	return func(yield func(int, R) bool) {
+		var (
+			pending = make([]chan R, 0, max) // results of the running workers, in index order
+			next    = 0                      // next index to start
+		)
+		for idx := 0; idx < n; idx++ {
+			for ; next < n && next < idx+max; next++ {
+				resc := make(chan R, 1)
+				go func(idx int) {
+					resc <- worker(idx)
+				}(next)
+				pending = append(pending, resc)
+			}
+			r := <-pending[0]
+			pending = pending[1:]
+			if !yield(idx, r) {
+				for _, resc := range pending {
+					<-resc
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package work_test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestCompleted(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) int {
+			return idx * 2
+		}
+		seen := make([]int, n)
+		for idx, r := range work.Completed(n, worker) {
+			if r != idx*2 {
+				t.Errorf("unexpected result for index %d: %d", idx, r)
+				t.FailNow()
+			}
+			seen[idx]++
+		}
+		for i, m := range seen {
+			if m != 1 {
+				t.Errorf("index %d seen %d times", i, m)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestCompletedStop(t *testing.T) {
+	const n = 1000
+	var started int32
+	worker := func(idx int) int {
+		atomic.AddInt32(&started, 1)
+		return idx
+	}
+	m := 0
+	for range work.Completed(n, worker) {
+		m++
+		if m == 3 {
+			break
+		}
+	}
+	if s := atomic.LoadInt32(&started); s == n {
+		t.Errorf("expected the remaining workers not to be started")
+		t.FailNow()
+	}
+}
+
+func TestLazy(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) int {
+			return idx * 2
+		}
+		next := 0
+		for idx, r := range work.Lazy(n, worker, 3) {
+			if idx != next || r != idx*2 {
+				t.Errorf("unexpected result for index %d: %d", idx, r)
+				t.FailNow()
+			}
+			next++
+		}
+		if next != n {
+			t.Errorf("unexpected number of results: got %d expected %d", next, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestLazyStop(t *testing.T) {
+	const (
+		n   = 100
+		max = 3
+	)
+	var started int32
+	worker := func(idx int) int {
+		atomic.AddInt32(&started, 1)
+		return idx
+	}
+	for idx := range work.Lazy(n, worker, max) {
+		if idx == 4 {
+			break
+		}
+	}
+	// items 0 to 4 plus the ones prefetched while consuming item 4
+	if s := atomic.LoadInt32(&started); s != 5+max-1 {
+		t.Errorf("unexpected started workers: got %d expected %d", s, 5+max-1)
+		t.FailNow()
+	}
+}
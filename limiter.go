@@ -0,0 +1,79 @@
+package work
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter is a concurrency budget shared by all the calls using it with WithLimiter.
+// It limits the total number of their running workers, on top of their own maximum.
+// Workers waiting for the budget are served by decreasing priority, as set by WithPriority,
+// and in arrival order within the same priority.
+type Limiter struct {
+	mu      sync.Mutex
+	n       int       // budget
+	used    int       // number of running workers
+	waiters []*waiter // sorted by decreasing priority
+}
+
+// waiter is a worker waiting for the budget of a Limiter.
+type waiter struct {
+	priority int
+	ready    chan struct{} // closed once the worker can run
+}
+
+// NewLimiter returns a Limiter allowing up to n workers to run at the same time.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{n: n}
+}
+
+// acquire blocks until a worker with the given priority can run and reports whether it can,
+// false if ctx was cancelled first.
+func (l *Limiter) acquire(ctx context.Context, priority int) bool {
+	l.mu.Lock()
+	if l.used < l.n && len(l.waiters) == 0 {
+		l.used++
+		l.mu.Unlock()
+		return true
+	}
+	w := &waiter{priority, make(chan struct{})}
+	i := len(l.waiters)
+	for i > 0 && l.waiters[i-1].priority < priority {
+		i--
+	}
+	l.waiters = append(l.waiters, nil)
+	copy(l.waiters[i+1:], l.waiters[i:])
+	l.waiters[i] = w
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	for i, x := range l.waiters {
+		if x == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			l.mu.Unlock()
+			return false
+		}
+	}
+	l.mu.Unlock()
+	// the budget was handed over in the meantime
+	l.release()
+	return false
+}
+
+// release gives back the budget of a worker that is done, handing it over to the first waiting one.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	if len(l.waiters) > 0 {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		close(w.ready)
+	} else {
+		l.used--
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,90 @@
+package work_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWithLimiter(t *testing.T) {
+	const (
+		calls  = 4
+		n      = 10
+		budget = 3
+	)
+	var (
+		l       = work.NewLimiter(budget)
+		running int32
+		peak    int32
+		wg      sync.WaitGroup
+	)
+	worker := func(idx int) {
+		r := atomic.AddInt32(&running, 1)
+		for p := atomic.LoadInt32(&peak); r > p; p = atomic.LoadInt32(&peak) {
+			if atomic.CompareAndSwapInt32(&peak, p, r) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}
+	wg.Add(calls)
+	for i := 0; i < calls; i++ {
+		go func() {
+			work.DoN(n, worker, nil, n, work.WithLimiter(l))
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if peak > budget {
+		t.Errorf("limiter budget exceeded: got %d expected at most %d", peak, budget)
+		t.FailNow()
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	var (
+		l       = work.NewLimiter(1)
+		mu      sync.Mutex
+		order   []string
+		wg      sync.WaitGroup
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	record := func(name string) func(int) {
+		return func(int) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+	// hold the whole budget while the other calls queue up
+	wg.Add(3)
+	go func() {
+		work.DoN(1, func(int) {
+			close(started)
+			<-release
+		}, nil, 1, work.WithLimiter(l))
+		wg.Done()
+	}()
+	<-started
+	go func() {
+		work.DoN(2, record("low"), nil, 1, work.WithLimiter(l))
+		wg.Done()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		work.DoN(2, record("high"), nil, 1, work.WithLimiter(l), work.WithPriority(1))
+		wg.Done()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if len(order) != 4 || order[0] != "high" {
+		t.Errorf("high priority call not served first: %v", order)
+		t.FailNow()
+	}
+}
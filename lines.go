@@ -0,0 +1,76 @@
+package work
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// LineError records the error returned by the worker for the line with number Line.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("work: line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the worker error.
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// linesPerWorker is the number of lines read ahead by DoLines for each worker.
+const linesPerWorker = 64
+
+// maxLineSize is the size of the longest line DoLines can read.
+const maxLineSize = 1 << 20
+
+// DoLines reads r line by line and spawns a worker for each line, limiting their numbers by max.
+// Lines are numbered from 1 and do not include their end of line marker.
+// They are read and processed in chunks of a few lines per worker, so that r is never read far ahead of the workers.
+// Lines longer than 1MiB cannot be read and make DoLines fail with bufio.ErrTooLong.
+// The first error encountered aborts all processing and is then returned as a LineError.
+// An error reading r is returned as is once the lines read before it are processed.
+// If finalizer is set, then it is called on the processed lines, in increasing line number order.
+// max must be positive.
+func DoLines(r io.Reader, worker func(lineNum int, line string) error, finalizer func(lineNum int, line string), max int) error {
+	if max <= 0 {
+		return fmt.Errorf("work: invalid max %d", max)
+	}
+	var (
+		lines = make([]string, 0, max*linesPerWorker)
+		// number of the first line in lines
+		first = 1
+		fn    func(idx int) error
+	)
+	if finalizer != nil {
+		fn = func(idx int) error {
+			finalizer(first+idx, lines[idx])
+			return nil
+		}
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+	for more := true; more; first += len(lines) {
+		lines = lines[:0]
+		for len(lines) < cap(lines) {
+			if more = s.Scan(); !more {
+				break
+			}
+			lines = append(lines, s.Text())
+		}
+		err := DoNWithError(len(lines), func(idx int) error {
+			if err := worker(first+idx, lines[idx]); err != nil {
+				return LineError{first + idx, err}
+			}
+			return nil
+		}, fn, max)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,112 @@
+package work_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoLines(t *testing.T) {
+	for _, n := range indexes {
+		var lines []string
+		for i := 0; i < n; i++ {
+			lines = append(lines, fmt.Sprintf("line %d", i+1))
+		}
+		r := strings.NewReader(strings.Join(lines, "\n"))
+		results := make([]string, n)
+		worker := func(num int, line string) error {
+			results[num-1] = strings.ToUpper(line)
+			return nil
+		}
+		var out []string
+		finalizer := func(num int, line string) {
+			out = append(out, results[num-1])
+		}
+		err := work.DoLines(r, worker, finalizer, 4)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if got, expected := strings.Join(out, "\n"), strings.ToUpper(strings.Join(lines, "\n")); got != expected {
+			t.Errorf("unexpected output: got %q expected %q", got, expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoLinesError(t *testing.T) {
+	r := strings.NewReader("a\nb\nc\nd\n")
+	worker := func(num int, line string) error {
+		if line == "c" {
+			return fmt.Errorf("fail")
+		}
+		return nil
+	}
+	var final []int
+	finalizer := func(num int, line string) {
+		final = append(final, num)
+	}
+	err := work.DoLines(r, worker, finalizer, 1)
+	var le work.LineError
+	if !errors.As(err, &le) || le.Line != 3 || le.Err.Error() != "fail" {
+		t.Errorf("expected error on line 3, got %v", err)
+		t.FailNow()
+	}
+	// the lines before the failed one may not all be finalized
+	if len(final) > 2 {
+		t.Errorf("unexpected finalized lines: %v", final)
+		t.FailNow()
+	}
+	for i, num := range final {
+		if num != i+1 {
+			t.Errorf("unexpected finalized lines: %v", final)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoLinesChunks(t *testing.T) {
+	// more lines than read at once, some longer than the default bufio.Scanner limit
+	const n = 1000
+	var lines []string
+	for i := 0; i < n; i++ {
+		line := fmt.Sprintf("line %d", i+1)
+		if i%100 == 0 {
+			line += strings.Repeat("x", 100<<10)
+		}
+		lines = append(lines, line)
+	}
+	r := strings.NewReader(strings.Join(lines, "\n"))
+	var final []string
+	err := work.DoLines(r, func(num int, line string) error {
+		if line != lines[num-1] {
+			return fmt.Errorf("unexpected line %q", line)
+		}
+		return nil
+	}, func(num int, line string) {
+		final = append(final, line)
+	}, 2)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if strings.Join(final, "\n") != strings.Join(lines, "\n") {
+		t.Errorf("unexpected finalized lines: got %d expected %d", len(final), n)
+		t.FailNow()
+	}
+}
+
+func TestDoLinesInvalidMax(t *testing.T) {
+	var called bool
+	err := work.DoLines(strings.NewReader("a\n"), func(int, string) error {
+		called = true
+		return nil
+	}, nil, 0)
+	if err == nil || called {
+		t.Errorf("expected invalid max error, got %v", err)
+		t.FailNow()
+	}
+}
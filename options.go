@@ -0,0 +1,519 @@
+package work
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Option customizes how items are processed by the functions accepting it.
+type Option func(*options)
+
+type options struct {
+	jitter           time.Duration // maximum random delay added to each dispatch
+	alwaysFinalize   bool          // finalize all items whose worker ran
+	reverseFinalize  bool          // finalize items in decreasing index order
+	limiter          *Limiter      // concurrency budget shared with other calls
+	nextIndex        func(remaining []int) int
+	failureThreshold int   // number of worker errors tolerated before aborting
+	yield            bool  // yield the processor between workers
+	warmup           []int // indexes run before processing starts
+	sampleInterval   time.Duration
+	sampler          func(pending, finalizerBacklog int)
+
+	batchFinalizer        func(aborted bool) error
+	batchFinalizerOnAbort bool
+
+	runtimeMax bool // limit running workers by SetRuntimeMax
+
+	shuffle     bool  // dispatch items in random order
+	shuffleSeed int64 // seed of the dispatch order
+
+	abortCause bool // return errors as AbortError
+
+	finalizerTimeout  time.Duration // maximum duration of a finalizer call
+	finalizerAttempts int           // maximum number of calls to the finalizer per item
+	finalizerBackoff  func(attempt int) time.Duration
+
+	skip            func(idx int) bool // items already processed
+	finalizeSkipped bool               // finalize the items reported by skip
+
+	onComplete  func(idx int, err error)
+	orderWindow int // number of positions an item can be finalized ahead of its turn
+
+	flushSize int // number of finalized items per flush
+	flushFunc func(indexes []int) error
+
+	gate         func() bool // whether workers can be dispatched
+	gateInterval time.Duration
+
+	rollback func(idx int) error // undo a finalized item
+	priority int                 // priority of the workers waiting for the limiter
+	coalesce bool                // hand completions over to the finalizer in bulk
+
+	panicConverter func(idx int, recovered any, stack []byte) error
+	clock          Clock
+
+	speculative float64
+
+	adaptive *AdaptiveConfig
+
+	backlogHigh int // number of items waiting for the finalizer above which dispatching is paused
+	backlogLow  int // number of items waiting for the finalizer at which dispatching resumes
+
+	progressEvery int
+	progressFunc  func(done, total int)
+
+	singleflight func(idx int) string
+
+	validate func(idx int) error
+
+	workerContext func(parent context.Context, idx int) context.Context
+
+	tracer Tracer
+
+	finalizers []func(idx int) error
+
+	dropOldest int
+
+	orderCheck bool
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithJitter delays the start of each worker by a random duration within [0, d),
+// spreading the load on the resources shared by workers.
+// The delay is spent in the worker goroutine, so it does not hold back the dispatch of the other items
+// but counts against the maximum number of concurrent workers.
+func WithJitter(d time.Duration) Option {
+	return func(o *options) {
+		o.jitter = d
+	}
+}
+
+// WithAlwaysFinalize calls the finalizer on every item whose worker was run,
+// even if the worker or another item failed, so that it can release resources.
+// Items are still finalized in increasing index order and the first error encountered is returned.
+// Items whose worker was not run because processing was aborted are not finalized.
+func WithAlwaysFinalize() Option {
+	return func(o *options) {
+		o.alwaysFinalize = true
+	}
+}
+
+// WithReverseFinalize calls the finalizer in decreasing index order, from n-1 down to 0,
+// e.g. to release resources in the reverse order of their acquisition.
+// Workers are also dispatched in decreasing index order.
+func WithReverseFinalize() Option {
+	return func(o *options) {
+		o.reverseFinalize = true
+	}
+}
+
+// WithLimiter draws the running workers from l, on top of the maximum of the call,
+// so that all the calls sharing l do not run more than its budget at the same time.
+func WithLimiter(l *Limiter) Option {
+	return func(o *options) {
+		o.limiter = l
+	}
+}
+
+// WithNextIndex lets next choose the index of the item to dispatch each time a worker can be started,
+// instead of dispatching them in increasing index order.
+// remaining holds the indexes of the items not dispatched yet, in increasing order,
+// and must not be modified. next must return one of them.
+// Items are still finalized in increasing index order.
+func WithNextIndex(next func(remaining []int) int) Option {
+	return func(o *options) {
+		o.nextIndex = next
+	}
+}
+
+// WithFailureThreshold tolerates up to k worker errors: processing is only aborted
+// once more than k workers have failed.
+// The returned error then combines the IndexError of all the failures so far, sorted by index.
+// If k or fewer workers failed, all the items are processed and their errors are returned the same way.
+// The items of failed workers are not finalized, which does not hold back the following ones.
+// With k set to 0, the first error aborts all processing and is returned as is.
+func WithFailureThreshold(k int) Option {
+	return func(o *options) {
+		o.failureThreshold = k
+	}
+}
+
+// WithYield yields the processor before each worker is started,
+// giving unrelated goroutines a chance to run between CPU bound workers, at the cost of some throughput.
+// Running workers are not affected: they are only preempted by the Go scheduler.
+func WithYield() Option {
+	return func(o *options) {
+		o.yield = true
+	}
+}
+
+// WithWarmup runs the worker on the given indexes, one after the other, before processing starts,
+// e.g. to prime caches. Errors returned by these runs are ignored and their items are not finalized:
+// whatever the worker produced for them is overwritten by the actual processing.
+func WithWarmup(indexes []int) Option {
+	return func(o *options) {
+		o.warmup = indexes
+	}
+}
+
+// WithQueueSampler calls cb every interval while items are being processed with
+// the number of items not handed to a worker yet and the number of items
+// whose worker completed but that were not finalized yet.
+// A growing finalizer backlog means that the finalizer cannot keep up with the workers.
+// If interval is not positive, it defaults to 10ms.
+func WithQueueSampler(interval time.Duration, cb func(pending, finalizerBacklog int)) Option {
+	if interval <= 0 {
+		interval = 10 * time.Millisecond
+	}
+	return func(o *options) {
+		o.sampleInterval = interval
+		o.sampler = cb
+	}
+}
+
+// WithBatchFinalizer calls f once all items are processed, after the last call to the finalizer,
+// e.g. to commit the whole batch. Its error is then returned.
+// By default, f is not called if processing was aborted. If onAbort is set, it is called anyway
+// with aborted set to true, its error being ignored in favor of the one that caused the abort.
+func WithBatchFinalizer(f func(aborted bool) error, onAbort bool) Option {
+	return func(o *options) {
+		o.batchFinalizer = f
+		o.batchFinalizerOnAbort = onAbort
+	}
+}
+
+// WithRuntimeMax limits the number of running workers by the value set with SetRuntimeMax, if any,
+// on top of the maximum of the call.
+func WithRuntimeMax() Option {
+	return func(o *options) {
+		o.runtimeMax = true
+	}
+}
+
+// WithShuffle dispatches workers in a random order, e.g. to spread the load when neighbouring indexes
+// hit the same resources. The order only depends on seed, so that it can be reproduced.
+// Items are still finalized in increasing index order. WithNextIndex takes precedence over it.
+func WithShuffle(seed int64) Option {
+	return func(o *options) {
+		o.shuffle = true
+		o.shuffleSeed = seed
+	}
+}
+
+// WithAbortCause returns the error that stopped processing as an *AbortError,
+// telling whether it was caused by a worker, the finalizer, a cancellation and so on.
+// The original error is still available with errors.Is and errors.As.
+func WithAbortCause() Option {
+	return func(o *options) {
+		o.abortCause = true
+	}
+}
+
+// WithFinalizerTimeout aborts processing if a single call to the finalizer lasts longer than d,
+// without waiting for it to return, e.g. when flushing to a hung disk.
+// The returned error is then an IndexError wrapping ErrFinalizerTimeout with the index of the stalled item:
+// the items before it in the finalization order were finalized.
+// The stalled call keeps running in the background and no other item is finalized.
+func WithFinalizerTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.finalizerTimeout = d
+	}
+}
+
+// WithFinalizerRetry calls the finalizer again on an item it failed to finalize, up to attempts times in total,
+// before aborting processing with its last error, e.g. to deliver items to a flaky sink.
+// The following items wait for the retries so that they are still finalized in order.
+// If backoff is set, it returns how long to wait before the given attempt, starting at 1 for the first retry.
+// The finalizer must therefore be idempotent. With WithFinalizerTimeout, the timeout covers all the attempts.
+func WithFinalizerRetry(attempts int, backoff func(attempt int) time.Duration) Option {
+	return func(o *options) {
+		o.finalizerAttempts = attempts
+		o.finalizerBackoff = backoff
+	}
+}
+
+// WithSkip does not run the worker on the items for which completed returns true,
+// e.g. the ones processed by a previous run of a resumable job.
+// They do not hold back the finalization of the following items and are only finalized if finalize is set.
+// Skipped items do not interrupt the watermark of DoWithErrorWatermark.
+// They are not dispatched to a worker: they do not wait for the gate, Limiter, jitter
+// or backpressure set by the other options.
+func WithSkip(completed func(idx int) bool, finalize bool) Option {
+	return func(o *options) {
+		o.skip = completed
+		o.finalizeSkipped = finalize
+	}
+}
+
+// WithOnComplete calls f with the index and error of each worker as soon as it returns,
+// without waiting for the items before it as the finalizer does, e.g. to trigger dependent work early.
+// f is called from the worker goroutines and must therefore be safe for concurrent use.
+// It holds back the finalization of its item until it returns.
+func WithOnComplete(f func(idx int, err error)) Option {
+	return func(o *options) {
+		o.onComplete = f
+	}
+}
+
+// WithOrderWindow relaxes the finalization order so that a slow item does not hold back all the following ones:
+// an item can be finalized ahead of its turn by up to w positions.
+// In other words, the item at position p is finalized as soon as its worker completed
+// and all the items before position p-w were finalized. A value of 0 keeps the strict order.
+// It has no effect along with WithAlwaysFinalize.
+func WithOrderWindow(w int) Option {
+	return func(o *options) {
+		o.orderWindow = w
+	}
+}
+
+// WithFinalizerBatch hands the finalized items over to flush in batches of size items instead of one at a time,
+// e.g. to write them to a remote store in a single request. The finalizer, if set, is still called on each item
+// before it is added to the current batch. Batches hold consecutive items in finalization order
+// and the last one may be partial. The indexes slice is owned by flush.
+// An error returned by flush aborts processing like a finalizer error: the items of the failed batch
+// are not finalized and with DoWithErrorWatermark, the watermark only covers the flushed items.
+// If size is not positive, items are flushed one at a time.
+func WithFinalizerBatch(size int, flush func(indexes []int) error) Option {
+	if size <= 0 {
+		size = 1
+	}
+	return func(o *options) {
+		o.flushSize = size
+		o.flushFunc = flush
+	}
+}
+
+// WithGate calls gate before dispatching each worker and, while it returns false, pauses dispatching,
+// polling it every interval, e.g. while the circuit breaker of a downstream service is open.
+// Running workers are not affected. If interval is not positive, it defaults to 10ms.
+func WithGate(gate func() bool, interval time.Duration) Option {
+	if interval <= 0 {
+		interval = 10 * time.Millisecond
+	}
+	return func(o *options) {
+		o.gate = gate
+		o.gateInterval = interval
+	}
+}
+
+// WithRollback calls rollback on every finalized item, in the reverse order of their finalization,
+// if processing fails or is cancelled, so that the effects of the finalizer are all or nothing.
+// Without a finalizer, it is called on the items whose worker succeeded.
+// All the items are rolled back regardless of rollback errors, which are then joined,
+// as IndexError sorted by index, to the error that caused the rollback.
+func WithRollback(rollback func(idx int) error) Option {
+	return func(o *options) {
+		o.rollback = rollback
+	}
+}
+
+// WithPriority sets the priority of the workers waiting for the Limiter set by WithLimiter.
+// Waiting workers with a higher priority get the budget of the limiter first, e.g. so that
+// a small latency sensitive call is not stuck behind the queued workers of a large background one.
+// Running workers are not preempted. The default priority is 0.
+func WithPriority(class int) Option {
+	return func(o *options) {
+		o.priority = class
+	}
+}
+
+// WithCoalescing lets workers hand their completed items over to the finalizer without waiting for it,
+// up to the maximum number of workers, the finalizer then processing all the available items at once.
+// Workers then do not block on a busy finalizer, although BenchmarkCoalescing shows no measurable
+// CPU gain for tiny workers, whose cost is dominated by their goroutine.
+func WithCoalescing() Option {
+	return func(o *options) {
+		o.coalesce = true
+	}
+}
+
+// WithPanicConverter recovers the panics of workers and turns them into worker errors with convert,
+// which receives the index of the worker, the recovered value and the stack trace of the panic,
+// as returned by debug.Stack. If convert is nil, the error holds the index, the recovered value and the stack.
+func WithPanicConverter(convert func(idx int, recovered any, stack []byte) error) Option {
+	if convert == nil {
+		convert = func(idx int, recovered any, stack []byte) error {
+			return fmt.Errorf("panic at %d: %v\n%s", idx, recovered, stack)
+		}
+	}
+	return func(o *options) {
+		o.panicConverter = convert
+	}
+}
+
+// WithClock makes the call use c for all its timing, such as jitter, timeouts and polling,
+// instead of the time package, e.g. to drive time from tests with worktest.FakeClock.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithSpeculative starts a backup worker for any item whose worker is still running past
+// the afterP percentile, in (0, 100], of the durations of the successful workers observed so far,
+// e.g. 95 to cut the tail latency caused by occasional stragglers.
+// The result of the first worker to return is used and the other one is cancelled and waited for,
+// so workers must be idempotent and return when their context is cancelled.
+// Nothing is speculated until a few durations were observed.
+// afterP is capped to 100 and speculation is disabled if it is not positive.
+func WithSpeculative(afterP float64) Option {
+	if afterP > 100 {
+		afterP = 100
+	}
+	return func(o *options) {
+		o.speculative = afterP
+	}
+}
+
+// WithAdaptiveConcurrency adjusts the number of running workers to their error rate, starting at the maximum
+// of the call: every cfg.Window worker results, the limit is multiplied by cfg.Decrease if the error rate
+// was above cfg.Threshold and is otherwise increased by one, up to the maximum.
+// Since the first worker error aborts the call, it is meant to be used with WithFailureThreshold.
+func WithAdaptiveConcurrency(cfg AdaptiveConfig) Option {
+	if cfg.Window <= 0 {
+		cfg.Window = 10
+	}
+	if cfg.Decrease <= 0 || cfg.Decrease >= 1 {
+		cfg.Decrease = 0.5
+	}
+	if cfg.Min <= 0 {
+		cfg.Min = 1
+	}
+	return func(o *options) {
+		o.adaptive = &cfg
+	}
+}
+
+// WithFinalizerBackpressure pauses the dispatching of workers when the number of items waiting
+// for the finalizer reaches high, until it drops to low, so that completed items do not pile up
+// while the finalizer falls behind, e.g. waiting for a slow item holding back all the following ones.
+// Dispatching still goes on if the finalizer waits for an item that was not dispatched yet.
+// It has no effect without a finalizer.
+func WithFinalizerBackpressure(high, low int) Option {
+	return func(o *options) {
+		o.backlogHigh = high
+		o.backlogLow = low
+	}
+}
+
+// WithProgressEvery calls cb with the number of processed items, finalized if there is a finalizer,
+// every time it reaches a multiple of k, and once all of them are processed, with done equal to total,
+// even if total is not a multiple of k.
+// cb is never called concurrently, nor with a number of items lower than in a previous call.
+func WithProgressEvery(k int, cb func(done, total int)) Option {
+	return func(o *options) {
+		o.progressEvery = k
+		o.progressFunc = cb
+	}
+}
+
+// WithSingleflight does not run the worker for an item if a worker for the same key, as returned by keyOf,
+// is already running, in this call or any other one using WithSingleflight:
+// it waits for that worker to return and gets its error instead, e.g. so that an expensive result
+// stored by key is only computed once. Keys are shared by all calls and should be namespaced accordingly.
+// A waiting worker returns early if its context is cancelled, and if the worker it waits for returns early
+// because its own context was cancelled, one of the waiting workers runs the worker instead.
+// Use WorkerWithSingleflight to share the value computed by the worker as well.
+func WithSingleflight(keyOf func(idx int) string) Option {
+	return func(o *options) {
+		o.singleflight = keyOf
+	}
+}
+
+// WithValidate calls validate on each processed item, in the finalizer order, right before finalizing it.
+// An error rejects the item, which is then not finalized, and aborts processing like a finalizer error,
+// the error being returned as an IndexError.
+// It has no effect without a finalizer.
+func WithValidate(validate func(idx int) error) Option {
+	return func(o *options) {
+		o.validate = validate
+	}
+}
+
+// WithWorkerContext derives the context of the worker for each item from the context of the batch
+// with derive, e.g. to attach a trace span or set a deadline for that item.
+// The returned context must be derived from parent so that the worker is cancelled when processing is aborted.
+// It only applies to the calls giving a context to their workers.
+func WithWorkerContext(derive func(parent context.Context, idx int) context.Context) Option {
+	return func(o *options) {
+		o.workerContext = derive
+	}
+}
+
+// WithTracer records a span with tracer for each call to the worker and the finalizer,
+// named "worker <idx>" and "finalizer <idx>", along with the error they return, if any.
+// Worker spans are children of the context given to the batch and their context is passed
+// to the workers, for the calls giving a context to their workers.
+// Spans are ended even if the call panics.
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithFinalizers hands the finalized items over to each of finalizers, in the same order.
+// Every one of them runs on its own goroutine, in parallel to the others and to the finalizer of the call,
+// and receives an item once the finalizer of the call, if any, returned for it.
+// An error returned by any of them aborts processing like a finalizer error.
+// The call returns once they are all done.
+func WithFinalizers(finalizers ...func(idx int) error) Option {
+	return func(o *options) {
+		o.finalizers = finalizers
+	}
+}
+
+// WithDropOldest makes Stream buffer up to size results for the consumer, overwriting the oldest
+// unconsumed one when the buffer is full instead of waiting for the consumer.
+// It intentionally drops results so that workers are never held back by a slow consumer,
+// which then sees the freshest results, e.g. to feed a live dashboard.
+// It only applies to Stream.
+func WithDropOldest(size int) Option {
+	return func(o *options) {
+		o.dropOldest = size
+	}
+}
+
+// WithOrderCheck verifies that every item is finalized after the previous one in the finalizer order,
+// as a cheap guard against ordering bugs. An item out of order is not finalized and aborts processing
+// like a finalizer error, the error being an IndexError wrapping ErrOutOfOrder.
+// It has no effect with WithOrderWindow, which relaxes the order on purpose.
+func WithOrderCheck() Option {
+	return func(o *options) {
+		o.orderCheck = true
+	}
+}
+
+// withoutError turns a worker that cannot fail into a context aware one.
+func withoutError(worker func(idx int)) func(context.Context, int) error {
+	return func(_ context.Context, idx int) error {
+		worker(idx)
+		return nil
+	}
+}
+
+// withoutContext turns a worker that does not use a context into a context aware one.
+func withoutContext(worker func(idx int) error) func(context.Context, int) error {
+	return func(_ context.Context, idx int) error {
+		return worker(idx)
+	}
+}
+
+// finalizerWithoutError turns a finalizer that cannot fail into one that can.
+func finalizerWithoutError(finalizer func(idx int)) func(int) error {
+	if finalizer == nil {
+		return nil
+	}
+	return func(idx int) error {
+		finalizer(idx)
+		return nil
+	}
+}
@@ -0,0 +1,1268 @@
+package work_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+	"github.com/pierrec/go-work/worktest"
+)
+
+func TestWithJitter(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		final := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = 1
+		}
+		pos := 0
+		finalizer := func(idx int) {
+			pos++
+			final[idx] = pos
+		}
+		work.Do(n, worker, finalizer, work.WithJitter(time.Millisecond))
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i+1 {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithJitterConcurrent(t *testing.T) {
+	// the delays are spent concurrently by the workers:
+	// they would take about n*jitter/2 if spent one after the other by the dispatcher
+	const n, jitter = 20, 50 * time.Millisecond
+	start := time.Now()
+	work.DoN(n, func(int) {}, nil, n, work.WithJitter(jitter))
+	if d := time.Since(start); d > n*jitter/4 {
+		t.Errorf("jitter delays were not concurrent: took %v", d)
+		t.FailNow()
+	}
+}
+
+func TestSingleItemFinalizer(t *testing.T) {
+	var final int
+	finalizer := func(idx int) {
+		final++
+	}
+	work.Do(1, func(int) {}, finalizer)
+	if final != 1 {
+		t.Errorf("expected the single item to be finalized")
+		t.FailNow()
+	}
+
+	final = 0
+	worker := func(int) error {
+		return fmt.Errorf("fail")
+	}
+	finalizerWithError := func(idx int) error {
+		final++
+		return nil
+	}
+	if err := work.DoWithError(1, worker, finalizerWithError); err == nil {
+		t.Errorf("expected error")
+		t.FailNow()
+	}
+	if final != 0 {
+		t.Errorf("unexpected finalization of the single failed item")
+		t.FailNow()
+	}
+
+	if err := work.DoWithError(1, worker, finalizerWithError, work.WithAlwaysFinalize()); err == nil {
+		t.Errorf("expected error")
+		t.FailNow()
+	}
+	if final != 1 {
+		t.Errorf("expected the single failed item to be finalized")
+		t.FailNow()
+	}
+}
+
+func TestWithAlwaysFinalize(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		var (
+			mu  sync.Mutex
+			ran = make([]bool, n)
+		)
+		worker := func(idx int) error {
+			mu.Lock()
+			ran[idx] = true
+			mu.Unlock()
+			if idx%2 > 0 {
+				return fmt.Errorf("fail")
+			}
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		err := work.DoWithError(n, worker, finalizer, work.WithAlwaysFinalize())
+		if err == nil {
+			t.Errorf("expected error")
+			t.FailNow()
+		}
+		var expected []int
+		for i, ok := range ran {
+			if ok {
+				expected = append(expected, i)
+			}
+		}
+		if fmt.Sprint(final) != fmt.Sprint(expected) {
+			t.Errorf("unexpected finalized items: got %v expected %v", final, expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithReverseFinalize(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = 1
+		}
+		var final []int
+		finalizer := func(idx int) {
+			final = append(final, idx)
+		}
+		work.Do(n, worker, finalizer, work.WithReverseFinalize())
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		if len(final) != n {
+			t.Errorf("unexpected final size: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			if idx != n-1-i {
+				t.Errorf("finalizer ran out of descending order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithNextIndex(t *testing.T) {
+	for _, n := range indexes {
+		var started []int
+		worker := func(idx int) {
+			started = append(started, idx)
+		}
+		var final []int
+		finalizer := func(idx int) {
+			final = append(final, idx)
+		}
+		// dispatch the highest indexes first
+		next := func(remaining []int) int {
+			return remaining[len(remaining)-1]
+		}
+		work.DoN(n, worker, finalizer, 1, work.WithNextIndex(next))
+		if len(started) != n || len(final) != n {
+			t.Errorf("unexpected number of items: started %d finalized %d expected %d", len(started), len(final), n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if started[i] != n-1-i {
+				t.Errorf("unexpected dispatch order: %v", started)
+				t.FailNow()
+			}
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithFailureThreshold(t *testing.T) {
+	const n = 8
+	// the first 2 items fail
+	worker := func(idx int) error {
+		if idx < 2 {
+			return fmt.Errorf("fail %d", idx)
+		}
+		return nil
+	}
+	var final []int
+	finalizer := func(idx int) error {
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoWithError(n, worker, finalizer, work.WithFailureThreshold(2))
+	var ierr work.IndexError
+	if !errors.As(err, &ierr) {
+		t.Errorf("expected index error, got %v", err)
+		t.FailNow()
+	}
+	if ierr.Index != 0 {
+		t.Errorf("unexpected first failed index: %d", ierr.Index)
+		t.FailNow()
+	}
+	if len(final) != n-2 {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+	for i, idx := range final {
+		if idx != i+2 {
+			t.Errorf("finalizer ran out of order: %v", final)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithFailureThresholdExceeded(t *testing.T) {
+	const n = 8
+	var processed int32
+	worker := func(idx int) error {
+		atomic.AddInt32(&processed, 1)
+		return fmt.Errorf("fail %d", idx)
+	}
+	err := work.DoNWithError(n, worker, nil, 1, work.WithFailureThreshold(2))
+	if err == nil {
+		t.Errorf("expected error")
+		t.FailNow()
+	}
+	if processed != 3 {
+		t.Errorf("unexpected number of processed items: got %d expected 3", processed)
+		t.FailNow()
+	}
+	for i := 0; i < 3; i++ {
+		if !strings.Contains(err.Error(), fmt.Sprintf("fail %d", i)) {
+			t.Errorf("missing failure %d in %v", i, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithYield(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = 1
+		}
+		work.Do(n, worker, nil, work.WithYield())
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithWarmup(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		var (
+			mu   sync.Mutex
+			runs = make([]int, n)
+		)
+		worker := func(idx int) error {
+			mu.Lock()
+			runs[idx]++
+			mu.Unlock()
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		err := work.DoWithError(n, worker, finalizer, work.WithWarmup([]int{0, 1}))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: %v", final)
+			t.FailNow()
+		}
+		for i, m := range runs {
+			expected := 1
+			if i < 2 {
+				expected = 2
+			}
+			if m != expected {
+				t.Errorf("unexpected runs for index %d: got %d expected %d", i, m, expected)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithQueueSampler(t *testing.T) {
+	const n = 20
+	var (
+		mu      sync.Mutex
+		samples int
+		backlog int
+	)
+	sampler := func(pending, finalizerBacklog int) {
+		mu.Lock()
+		samples++
+		if pending < 0 || pending > n || finalizerBacklog < 0 || finalizerBacklog > n {
+			t.Errorf("unexpected sample: %d %d", pending, finalizerBacklog)
+		}
+		if finalizerBacklog > backlog {
+			backlog = finalizerBacklog
+		}
+		mu.Unlock()
+	}
+	worker := func(idx int) {}
+	// a slow finalizer builds up a backlog
+	finalizer := func(idx int) {
+		time.Sleep(time.Millisecond)
+	}
+	work.DoN(n, worker, finalizer, n, work.WithQueueSampler(time.Millisecond, sampler))
+	mu.Lock()
+	defer mu.Unlock()
+	if samples == 0 || backlog == 0 {
+		t.Errorf("expected samples with a finalizer backlog: %d samples, max backlog %d", samples, backlog)
+		t.FailNow()
+	}
+	// the sampler is stopped once the call returns
+	m := samples
+	mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	mu.Lock()
+	if samples != m {
+		t.Errorf("sampler still running after the call returned")
+		t.FailNow()
+	}
+}
+
+func TestWithQueueSamplerNotPositive(t *testing.T) {
+	const n = 5
+	var samples int32
+	sampler := func(pending, finalizerBacklog int) {
+		atomic.AddInt32(&samples, 1)
+	}
+	// the call lasts about 50ms, sampled every 10ms by default
+	work.DoN(n, func(int) {}, func(int) {
+		time.Sleep(10 * time.Millisecond)
+	}, n, work.WithQueueSampler(0, sampler))
+	if m := atomic.LoadInt32(&samples); m > 4*n {
+		t.Errorf("unexpected number of samples: %d", m)
+		t.FailNow()
+	}
+}
+
+func TestWithBatchFinalizer(t *testing.T) {
+	for _, n := range indexes {
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		var calls int
+		batchFinalizer := func(aborted bool) error {
+			calls++
+			if aborted {
+				t.Errorf("unexpected abort")
+			}
+			if len(final) != n {
+				t.Errorf("batch finalizer called before the last finalizer: %v", final)
+			}
+			return fmt.Errorf("commit")
+		}
+		err := work.DoWithError(n, func(int) error { return nil }, finalizer, work.WithBatchFinalizer(batchFinalizer, false))
+		if err == nil || err.Error() != "commit" {
+			t.Errorf("expected batch finalizer error, got %v", err)
+			t.FailNow()
+		}
+		if calls != 1 {
+			t.Errorf("unexpected batch finalizer calls: %d", calls)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithBatchFinalizerOnAbort(t *testing.T) {
+	worker := func(idx int) error {
+		return fmt.Errorf("fail")
+	}
+	for _, onAbort := range []bool{false, true} {
+		var calls int
+		batchFinalizer := func(aborted bool) error {
+			calls++
+			if !aborted {
+				t.Errorf("expected abort")
+			}
+			return fmt.Errorf("commit")
+		}
+		err := work.DoWithError(4, worker, nil, work.WithBatchFinalizer(batchFinalizer, onAbort))
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected worker error, got %v", err)
+			t.FailNow()
+		}
+		if expected := map[bool]int{false: 0, true: 1}[onAbort]; calls != expected {
+			t.Errorf("unexpected batch finalizer calls: got %d expected %d", calls, expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithShuffle(t *testing.T) {
+	for _, n := range indexes {
+		run := func() (started, final []int) {
+			worker := func(idx int) {
+				started = append(started, idx)
+			}
+			finalizer := func(idx int) {
+				final = append(final, idx)
+			}
+			work.DoN(n, worker, finalizer, 1, work.WithShuffle(42))
+			return
+		}
+		started, final := run()
+		seen := make([]int, n)
+		for _, idx := range started {
+			seen[idx]++
+		}
+		for _, c := range seen {
+			if c != 1 {
+				t.Errorf("unexpected dispatched items: %v", started)
+				t.FailNow()
+			}
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+		if again, _ := run(); fmt.Sprint(again) != fmt.Sprint(started) {
+			t.Errorf("dispatch order not reproducible: got %v expected %v", again, started)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithFinalizerTimeout(t *testing.T) {
+	const n = 8
+	var final []int
+	release := make(chan struct{})
+	finalizer := func(idx int) error {
+		if idx == 2 {
+			// hang until the test is over
+			<-release
+		}
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoNWithError(n, func(int) error { return nil }, finalizer, 2, work.WithFinalizerTimeout(10*time.Millisecond))
+	var ie work.IndexError
+	if !errors.As(err, &ie) || ie.Index != 2 || !errors.Is(err, work.ErrFinalizerTimeout) {
+		t.Errorf("expected finalizer timeout at index 2, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 1]" {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+	close(release)
+}
+
+func TestWithFinalizerTimeoutNoStall(t *testing.T) {
+	for _, n := range indexes {
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		err := work.DoWithError(n, func(int) error { return nil }, finalizer, work.WithFinalizerTimeout(time.Second))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: %v", final)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithFinalizerRetry(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			final    []int
+			attempts = make(map[int]int)
+			backoffs []int
+		)
+		// every item fails twice before being finalized
+		finalizer := func(idx int) error {
+			attempts[idx]++
+			if attempts[idx] < 3 {
+				return fmt.Errorf("fail %d", idx)
+			}
+			final = append(final, idx)
+			return nil
+		}
+		backoff := func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return 0
+		}
+		err := work.DoWithError(n, func(int) error { return nil }, finalizer, work.WithFinalizerRetry(3, backoff))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+		if len(backoffs) != 2*n {
+			t.Errorf("unexpected backoffs: %v", backoffs)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithFinalizerRetryExhausted(t *testing.T) {
+	var calls int
+	finalizer := func(idx int) error {
+		calls++
+		return fmt.Errorf("fail")
+	}
+	err := work.DoNWithError(4, func(int) error { return nil }, finalizer, 1, work.WithFinalizerRetry(3, nil))
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected finalizer error, got %v", err)
+		t.FailNow()
+	}
+	if calls != 3 {
+		t.Errorf("unexpected finalizer calls: got %d expected 3", calls)
+		t.FailNow()
+	}
+}
+
+func TestWithSkip(t *testing.T) {
+	for _, n := range indexes {
+		for _, finalize := range []bool{false, true} {
+			// even items were processed by a previous run
+			completed := func(idx int) bool { return idx%2 == 0 }
+			var (
+				mu      sync.Mutex
+				started []int
+				final   []int
+			)
+			worker := func(idx int) error {
+				mu.Lock()
+				started = append(started, idx)
+				mu.Unlock()
+				return nil
+			}
+			finalizer := func(idx int) error {
+				final = append(final, idx)
+				return nil
+			}
+			last, err := work.DoWithErrorWatermark(n, worker, finalizer, work.WithSkip(completed, finalize))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				t.FailNow()
+			}
+			if last != n-1 {
+				t.Errorf("unexpected watermark: got %d expected %d", last, n-1)
+				t.FailNow()
+			}
+			for _, idx := range started {
+				if completed(idx) {
+					t.Errorf("completed item %d was dispatched", idx)
+					t.FailNow()
+				}
+			}
+			if len(started) != n/2 {
+				t.Errorf("unexpected dispatched items: %v", started)
+				t.FailNow()
+			}
+			for i := 1; i < len(final); i++ {
+				if final[i] < final[i-1] {
+					t.Errorf("finalizer ran out of order: %v", final)
+					t.FailNow()
+				}
+			}
+			if expected := map[bool]int{false: n / 2, true: n}[finalize]; len(final) != expected {
+				t.Errorf("unexpected finalized items: got %v expected %d of them", final, expected)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithSkipNotDispatched(t *testing.T) {
+	const n = 8
+	// a closed gate, an exhausted limiter and a long jitter would block any dispatched item
+	done := make(chan error, 1)
+	go func() {
+		done <- work.DoNWithError(n, func(int) error { return nil }, func(int) error { return nil }, 2,
+			work.WithSkip(func(int) bool { return true }, false),
+			work.WithGate(func() bool { return false }, time.Millisecond),
+			work.WithLimiter(work.NewLimiter(0)),
+			work.WithJitter(time.Hour))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("skipped items were dispatched")
+		t.FailNow()
+	}
+}
+
+func TestWithOnComplete(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		var (
+			mu        sync.Mutex
+			completed = make(map[int]error)
+		)
+		release := make(chan struct{})
+		worker := func(idx int) error {
+			if idx == 0 {
+				// item 0 completes once all the others were reported
+				<-release
+			}
+			if idx%2 > 0 {
+				return fmt.Errorf("fail %d", idx)
+			}
+			return nil
+		}
+		onComplete := func(idx int, err error) {
+			mu.Lock()
+			completed[idx] = err
+			if len(completed) == n-1 {
+				close(release)
+			}
+			mu.Unlock()
+		}
+		err := work.DoNWithError(n, worker, nil, n, work.WithFailureThreshold(n), work.WithOnComplete(onComplete))
+		if err == nil {
+			t.Errorf("expected worker errors")
+			t.FailNow()
+		}
+		if len(completed) != n {
+			t.Errorf("unexpected completed items: got %d expected %d", len(completed), n)
+			t.FailNow()
+		}
+		for idx, err := range completed {
+			if (err != nil) != (idx%2 > 0) {
+				t.Errorf("unexpected error for index %d: %v", idx, err)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithOrderWindow(t *testing.T) {
+	const n, w = 8, 2
+	// item 0 completes once item w is finalized ahead of it
+	release := make(chan struct{})
+	worker := func(idx int) error {
+		if idx == 0 {
+			select {
+			case <-release:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("item %d not finalized ahead of item 0", w)
+			}
+		}
+		return nil
+	}
+	var final []int
+	finalized := make(map[int]bool)
+	finalizer := func(idx int) error {
+		for i := 0; i < idx-w; i++ {
+			if !finalized[i] {
+				t.Errorf("item %d finalized before item %d: %v", idx, i, final)
+			}
+		}
+		finalized[idx] = true
+		final = append(final, idx)
+		if idx == w {
+			close(release)
+		}
+		return nil
+	}
+	err := work.DoNWithError(n, worker, finalizer, n, work.WithOrderWindow(w))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if len(final) != n {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+}
+
+func TestWithFinalizerBatch(t *testing.T) {
+	const size = 3
+	for _, n := range indexes {
+		var batches [][]int
+		flush := func(indexes []int) error {
+			batches = append(batches, indexes)
+			return nil
+		}
+		work.Do(n, func(int) {}, nil, work.WithFinalizerBatch(size, flush))
+		var all []int
+		for i, batch := range batches {
+			if len(batch) != size && i != len(batches)-1 || len(batch) == 0 {
+				t.Errorf("unexpected batch sizes: %v", batches)
+				t.FailNow()
+			}
+			all = append(all, batch...)
+		}
+		if len(all) != n {
+			t.Errorf("unexpected flushed items: %v", batches)
+			t.FailNow()
+		}
+		for i, idx := range all {
+			if idx != i {
+				t.Errorf("items flushed out of order: %v", batches)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithFinalizerBatchNotPositive(t *testing.T) {
+	const n = 8
+	var batches [][]int
+	flush := func(indexes []int) error {
+		batches = append(batches, indexes)
+		return nil
+	}
+	work.Do(n, func(int) {}, nil, work.WithFinalizerBatch(0, flush))
+	if fmt.Sprint(batches) != "[[0] [1] [2] [3] [4] [5] [6] [7]]" {
+		t.Errorf("expected one item per batch, got %v", batches)
+		t.FailNow()
+	}
+}
+
+func TestWithFinalizerBatchError(t *testing.T) {
+	const n = 8
+	// the second batch fails
+	var flushes int
+	flush := func(indexes []int) error {
+		flushes++
+		if flushes == 2 {
+			return fmt.Errorf("fail")
+		}
+		return nil
+	}
+	last, err := work.DoNWithErrorWatermark(n, func(int) error { return nil }, func(int) error { return nil }, 1,
+		work.WithFinalizerBatch(2, flush))
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected flush error, got %v", err)
+		t.FailNow()
+	}
+	if last != 1 {
+		t.Errorf("unexpected watermark: got %d expected 1", last)
+		t.FailNow()
+	}
+}
+
+func TestWithGate(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		var (
+			open    atomic.Bool
+			started int32
+		)
+		open.Store(true)
+		worker := func(idx int) {
+			atomic.AddInt32(&started, 1)
+			if idx == 0 {
+				// close the gate until the test reopens it
+				open.Store(false)
+			}
+		}
+		done := make(chan struct{})
+		go func() {
+			work.DoN(n, worker, nil, 1, work.WithGate(open.Load, time.Millisecond))
+			close(done)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		if s := atomic.LoadInt32(&started); s != 1 {
+			t.Errorf("workers dispatched while the gate was closed: %d", s)
+			t.FailNow()
+		}
+		open.Store(true)
+		<-done
+		if s := atomic.LoadInt32(&started); s != int32(n) {
+			t.Errorf("unexpected dispatched workers: got %d expected %d", s, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithRollback(t *testing.T) {
+	const n = 8
+	var final, undone []int
+	finalizer := func(idx int) error {
+		if idx == 3 {
+			return fmt.Errorf("fail")
+		}
+		final = append(final, idx)
+		return nil
+	}
+	rollback := func(idx int) error {
+		undone = append(undone, idx)
+		if idx == 1 {
+			return fmt.Errorf("rollback %d", idx)
+		}
+		return nil
+	}
+	err := work.DoNWithError(n, func(int) error { return nil }, finalizer, 1, work.WithRollback(rollback))
+	if err == nil || !strings.HasPrefix(err.Error(), "fail\n") || !strings.Contains(err.Error(), "rollback 1") {
+		t.Errorf("expected finalizer and rollback errors, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 1 2]" || fmt.Sprint(undone) != "[2 1 0]" {
+		t.Errorf("unexpected rollback: finalized %v rolled back %v", final, undone)
+		t.FailNow()
+	}
+}
+
+func TestWithRollbackSuccess(t *testing.T) {
+	rollback := func(idx int) error {
+		t.Errorf("unexpected rollback of item %d", idx)
+		return nil
+	}
+	err := work.DoWithError(4, func(int) error { return nil }, func(int) error { return nil }, work.WithRollback(rollback))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestWithCoalescing(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = 1
+		}
+		var final []int
+		finalizer := func(idx int) {
+			final = append(final, idx)
+		}
+		work.Do(n, worker, finalizer, work.WithCoalescing())
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithPanicConverter(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		worker := func(idx int) error {
+			if idx == 1 {
+				panic("boom")
+			}
+			return nil
+		}
+		var stack []byte
+		convert := func(idx int, recovered any, s []byte) error {
+			stack = s
+			return fmt.Errorf("panic %d: %v", idx, recovered)
+		}
+		err := work.DoNWithError(n, worker, nil, 1, work.WithPanicConverter(convert), work.WithAbortCause())
+		var ae *work.AbortError
+		if !errors.As(err, &ae) || ae.Cause != work.CausePanic || ae.Err.Error() != "panic 1: boom" {
+			t.Errorf("expected converted panic, got %v", err)
+			t.FailNow()
+		}
+		if !strings.Contains(string(stack), "TestWithPanicConverter") {
+			t.Errorf("stack does not point at the worker:\n%s", stack)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithPanicConverterDefault(t *testing.T) {
+	worker := func(idx int) error {
+		panic("boom")
+	}
+	err := work.DoNWithError(1, worker, nil, 1, work.WithPanicConverter(nil))
+	if err == nil || !strings.HasPrefix(err.Error(), "panic at 0: boom\n") {
+		t.Errorf("expected converted panic, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	const n = 8
+	clock := worktest.NewFakeClock(time.Unix(0, 0))
+	var final []int
+	release := make(chan struct{})
+	finalizer := func(idx int) error {
+		if idx == 2 {
+			// only time out once the fake clock moved
+			clock.WaitTimers(1)
+			clock.Advance(time.Hour)
+			<-release
+		}
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoNWithError(n, func(int) error { return nil }, finalizer, 2,
+		work.WithFinalizerTimeout(time.Hour), work.WithClock(clock))
+	if !errors.Is(err, work.ErrFinalizerTimeout) {
+		t.Errorf("expected finalizer timeout, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 1]" {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+	close(release)
+}
+
+func TestWithSpeculative(t *testing.T) {
+	const n, slow = 20, 15
+	// percentiles above 100 are capped
+	for _, afterP := range []float64{90, 150} {
+		var (
+			attempts = make([]int32, n)
+			results  = make([]int32, n)
+		)
+		worker := func(ctx context.Context, idx int) error {
+			if atomic.AddInt32(&attempts[idx], 1) == 1 && idx == slow {
+				// straggler only returning once cancelled
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			atomic.StoreInt32(&results[idx], 1)
+			return nil
+		}
+		err := work.DoNWithContext(context.Background(), n, worker, nil, 1, work.WithSpeculative(afterP))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		for idx, r := range results {
+			if r != 1 {
+				t.Errorf("item %d not processed", idx)
+				t.FailNow()
+			}
+		}
+		if attempts[slow] != 2 {
+			t.Errorf("expected a backup worker for the straggler, got %d attempts", attempts[slow])
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithFinalizerBackpressure(t *testing.T) {
+	const n, max, high, low = 200, 8, 16, 4
+	// the first item holds back the finalization of all the others
+	worker := func(idx int) error {
+		if idx == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}
+	var final []int
+	finalizer := func(idx int) error {
+		final = append(final, idx)
+		return nil
+	}
+	stats, err := work.DoNWithStats(n, worker, finalizer, max, work.WithFinalizerBackpressure(high, low))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if len(final) != n {
+		t.Errorf("unexpected finalized items: got %d expected %d", len(final), n)
+		t.FailNow()
+	}
+	if stats.MaxBufferLen > high+max {
+		t.Errorf("backlog too large: got %d expected at most %d", stats.MaxBufferLen, high+max)
+		t.FailNow()
+	}
+}
+
+func TestWithFinalizerBackpressureShuffle(t *testing.T) {
+	for _, n := range indexes {
+		var final []int
+		// items are not dispatched in the order they are finalized
+		work.DoN(n, func(int) {}, func(idx int) {
+			final = append(final, idx)
+		}, 4, work.WithShuffle(1), work.WithFinalizerBackpressure(2, 1))
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithProgressEvery(t *testing.T) {
+	const n, k = 2500, 1000
+	var calls []int
+	cb := func(done, total int) {
+		if total != n {
+			t.Errorf("unexpected total: got %d expected %d", total, n)
+		}
+		calls = append(calls, done)
+	}
+	work.Do(n, func(int) {}, func(int) {}, work.WithProgressEvery(k, cb))
+	if fmt.Sprint(calls) != "[1000 2000 2500]" {
+		t.Errorf("unexpected progress: %v", calls)
+		t.FailNow()
+	}
+
+	// without a finalizer, workers report their progress concurrently
+	calls = nil
+	work.Do(n, func(int) {}, nil, work.WithProgressEvery(k, cb))
+	if len(calls) == 0 || calls[len(calls)-1] != n {
+		t.Errorf("unexpected progress: %v", calls)
+		t.FailNow()
+	}
+	for i := 1; i < len(calls); i++ {
+		if calls[i] <= calls[i-1] || calls[i]%k != 0 && calls[i] != n {
+			t.Errorf("unexpected progress: %v", calls)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithSingleflight(t *testing.T) {
+	const n = 8
+	var (
+		runs    int32
+		keys    int32
+		entered = make(chan struct{})
+	)
+	keyOf := func(idx int) string {
+		if atomic.AddInt32(&keys, 1) == 2*n {
+			close(entered)
+		}
+		return "TestWithSingleflight"
+	}
+	worker := func(idx int) error {
+		atomic.AddInt32(&runs, 1)
+		// wait for all the workers of both calls to join
+		<-entered
+		time.Sleep(10 * time.Millisecond)
+		return fmt.Errorf("fail")
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = work.DoNWithError(n, worker, nil, n, work.WithSingleflight(keyOf))
+		}(i)
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Errorf("unexpected number of runs: got %d expected 1", runs)
+		t.FailNow()
+	}
+	for _, err := range errs {
+		if err == nil || err.Error() != "fail" {
+			t.Errorf("expected the shared error, got %v", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWithSingleflightLeaderCancelled(t *testing.T) {
+	const key = "TestWithSingleflightLeaderCancelled"
+	keyOf := func(int) string { return key }
+	// the first call leads the key until it is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	entered := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		errc <- work.DoNWithContext(ctx, 1, func(ctx context.Context, idx int) error {
+			close(entered)
+			<-ctx.Done()
+			return ctx.Err()
+		}, nil, 1, work.WithSingleflight(keyOf))
+	}()
+	<-entered
+
+	// the second call waits for the first one, then runs its own worker
+	var runs int32
+	waiting := make(chan struct{})
+	go func() {
+		<-waiting
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := work.DoNWithError(1, func(int) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, nil, 1, work.WithSingleflight(func(idx int) string {
+		close(waiting)
+		return keyOf(idx)
+	}))
+	if err != nil || runs != 1 {
+		t.Errorf("unexpected error: %v (%d runs)", err, runs)
+		t.FailNow()
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("expected context error, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestWithValidate(t *testing.T) {
+	const n = 8
+	var validated, final []int
+	validate := func(idx int) error {
+		validated = append(validated, idx)
+		if idx == 2 {
+			return fmt.Errorf("invalid")
+		}
+		return nil
+	}
+	finalizer := func(idx int) error {
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoNWithError(n, func(int) error { return nil }, finalizer, 2, work.WithValidate(validate), work.WithAbortCause())
+	var ae *work.AbortError
+	var ie work.IndexError
+	if !errors.As(err, &ae) || ae.Cause != work.CauseValidation || !errors.As(err, &ie) || ie.Index != 2 {
+		t.Errorf("expected validation error at index 2, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(validated) != "[0 1 2]" || fmt.Sprint(final) != "[0 1]" {
+		t.Errorf("unexpected validated %v and finalized %v items", validated, final)
+		t.FailNow()
+	}
+}
+
+func TestWithFinalizers(t *testing.T) {
+	for _, n := range indexes {
+		var final, disk, index []int
+		record := func(s *[]int) func(int) error {
+			return func(idx int) error {
+				*s = append(*s, idx)
+				return nil
+			}
+		}
+		err := work.DoNWithError(n, func(int) error { return nil }, record(&final), 4,
+			work.WithFinalizers(record(&disk), record(&index)))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		for _, s := range [][]int{final, disk, index} {
+			if len(s) != n {
+				t.Errorf("unexpected finalized items: %v", s)
+				t.FailNow()
+			}
+			for i, idx := range s {
+				if i != idx {
+					t.Errorf("finalizer ran out of order: %v", s)
+					t.FailNow()
+				}
+			}
+		}
+	}
+}
+
+func TestWithFinalizersError(t *testing.T) {
+	const n = 8
+	fail := func(idx int) error {
+		if idx == 2 {
+			return fmt.Errorf("fail")
+		}
+		return nil
+	}
+	err := work.DoNWithError(n, func(int) error { return nil }, nil, 4, work.WithFinalizers(fail))
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected finalizer error, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestWithOrderCheck(t *testing.T) {
+	for _, n := range indexes {
+		for _, opts := range [][]work.Option{
+			{work.WithOrderCheck()},
+			{work.WithOrderCheck(), work.WithReverseFinalize()},
+			{work.WithOrderCheck(), work.WithOrderWindow(2)},
+			{work.WithOrderCheck(), work.WithCoalescing()},
+		} {
+			var final []int
+			err := work.DoNWithError(n, func(int) error { return nil }, func(idx int) error {
+				final = append(final, idx)
+				return nil
+			}, 4, opts...)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				t.FailNow()
+			}
+			if len(final) != n {
+				t.Errorf("unexpected finalized items: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestWithOrderCheckSkipped(t *testing.T) {
+	const n = 8
+	// items 1 and 5 are skipped, items 3 and 7 fail within the threshold
+	skip := func(idx int) bool { return idx%4 == 1 }
+	worker := func(idx int) error {
+		if idx%4 == 3 {
+			return fmt.Errorf("fail")
+		}
+		return nil
+	}
+	var final []int
+	err := work.DoNWithError(n, worker, func(idx int) error {
+		final = append(final, idx)
+		return nil
+	}, 1, work.WithOrderCheck(), work.WithSkip(skip, false), work.WithFailureThreshold(n))
+	if err == nil || errors.Is(err, work.ErrOutOfOrder) {
+		t.Errorf("expected worker errors only, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != "[0 2 4 6]" {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,24 @@
+package work
+
+import "sync/atomic"
+
+// DoWithExecutionOrder spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to Do but it also returns the indexes of the workers in the order they started
+// and in the order they completed.
+func DoWithExecutionOrder(n int, worker, finalizer func(idx int)) (startOrder, completeOrder []int) {
+	return DoNWithExecutionOrder(n, worker, finalizer, numRoutines)
+}
+
+// DoNWithExecutionOrder spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithExecutionOrder.
+func DoNWithExecutionOrder(n int, worker, finalizer func(idx int), max int) (startOrder, completeOrder []int) {
+	var started, completed int64
+	startOrder = make([]int, n)
+	completeOrder = make([]int, n)
+	DoN(n, func(idx int) {
+		startOrder[atomic.AddInt64(&started, 1)-1] = idx
+		worker(idx)
+		completeOrder[atomic.AddInt64(&completed, 1)-1] = idx
+	}, finalizer, max)
+	return
+}
@@ -0,0 +1,35 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCheckOrderOutOfOrder(t *testing.T) {
+	var final []int
+	finalizer := func(idx int) error {
+		final = append(final, idx)
+		return nil
+	}
+	b := newBatch(context.Background(), 4, func(context.Context, int) error { return nil }, finalizer, 1,
+		[]Option{WithOrderCheck()})
+
+	// item 0 was passed over, item 1 is the next one
+	b.skipOrder(0)
+	if _, err := b.finalizeItem(1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	// item 2 is missing
+	_, err := b.finalizeItem(3)
+	var ie IndexError
+	if !errors.As(err, &ie) || ie.Index != 3 || !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("expected out of order error at index 3, got %v", err)
+		t.FailNow()
+	}
+	if len(final) != 1 || final[0] != 1 {
+		t.Errorf("unexpected finalized items: %v", final)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,40 @@
+package work_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithExecutionOrder(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) {}
+		startOrder, completeOrder := work.DoWithExecutionOrder(n, worker, nil)
+		for _, order := range [][]int{startOrder, completeOrder} {
+			if len(order) != n {
+				t.Errorf("unexpected order size: got %d expected %d", len(order), n)
+				t.FailNow()
+			}
+			sorted := append([]int(nil), order...)
+			sort.Ints(sorted)
+			for i, idx := range sorted {
+				if idx != i {
+					t.Errorf("unexpected indexes: %v", order)
+					t.FailNow()
+				}
+			}
+		}
+	}
+}
+
+func TestDoWithExecutionOrderSequential(t *testing.T) {
+	const n = 5
+	startOrder, completeOrder := work.DoNWithExecutionOrder(n, func(int) {}, nil, 1)
+	for i := 0; i < n; i++ {
+		if startOrder[i] != i || completeOrder[i] != i {
+			t.Errorf("unexpected order: started %v completed %v", startOrder, completeOrder)
+			t.FailNow()
+		}
+	}
+}
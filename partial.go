@@ -0,0 +1,35 @@
+package work
+
+// DoPartial spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and returns once the first k items are finalized, in increasing index order.
+// The remaining items keep being processed and finalized, still in order, in the background:
+// the returned wait function blocks until they are all done.
+// Since workers and finalizer cannot fail, neither can the background processing.
+// If k is greater than or equal to n, DoPartial returns once all items are finalized.
+func DoPartial(n, k int, worker, finalizer func(idx int)) (wait func()) {
+	var (
+		partc = make(chan struct{}) // closed once k items are finalized
+		donec = make(chan struct{}) // closed once all items are finalized
+	)
+	if k > n {
+		k = n
+	}
+	if k <= 0 {
+		close(partc)
+	}
+	go func() {
+		Do(n, worker, func(idx int) {
+			if finalizer != nil {
+				finalizer(idx)
+			}
+			if idx == k-1 {
+				close(partc)
+			}
+		})
+		close(donec)
+	}()
+	<-partc
+	return func() {
+		<-donec
+	}
+}
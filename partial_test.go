@@ -0,0 +1,49 @@
+package work_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoPartial(t *testing.T) {
+	for _, n := range indexes {
+		k := n / 2
+		var (
+			mu    sync.Mutex
+			final []int
+		)
+		release := make(chan struct{})
+		worker := func(idx int) {
+			if idx >= k {
+				// the remaining items only complete once released
+				<-release
+			}
+		}
+		finalizer := func(idx int) {
+			mu.Lock()
+			final = append(final, idx)
+			mu.Unlock()
+		}
+		wait := work.DoPartial(n, k, worker, finalizer)
+		mu.Lock()
+		if len(final) != k {
+			t.Errorf("unexpected finalized items on return: got %d expected %d", len(final), k)
+			t.FailNow()
+		}
+		mu.Unlock()
+		close(release)
+		wait()
+		if len(final) != n {
+			t.Errorf("unexpected final size: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			if idx != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package work
+
+import "sync"
+
+// DoPooled spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Each worker receives a scratch object taken from a sync.Pool, filled by newBuf, and given back
+// once the worker returns, so that it is never used by two workers at the same time.
+// The object is handed as is to the next worker and must be reset by the worker if needed.
+// B should be a pointer type to avoid allocating when the object is put back into the pool.
+func DoPooled[B any](n int, newBuf func() B, worker func(idx int, buf B)) {
+	pool := sync.Pool{
+		New: func() any { return newBuf() },
+	}
+	Do(n, func(idx int) {
+		buf := pool.Get().(B)
+		worker(idx, buf)
+		pool.Put(buf)
+	}, nil)
+}
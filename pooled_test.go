@@ -0,0 +1,42 @@
+package work_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoPooled(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu    sync.Mutex
+			inUse = make(map[*[]byte]bool)
+		)
+		results := make([]int, n)
+		newBuf := func() *[]byte {
+			buf := make([]byte, 0, 64)
+			return &buf
+		}
+		worker := func(idx int, buf *[]byte) {
+			mu.Lock()
+			if inUse[buf] {
+				t.Errorf("buffer shared by concurrent workers")
+			}
+			inUse[buf] = true
+			mu.Unlock()
+
+			*buf = append((*buf)[:0], byte(idx))
+			results[idx] = int((*buf)[0]) + 1
+
+			mu.Lock()
+			inUse[buf] = false
+			mu.Unlock()
+		}
+		work.DoPooled(n, newBuf, worker)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package work
+
+import "sync"
+
+// DoQueue runs produce in its own goroutine and spawns up to max workers processing the items it emits.
+// emit blocks until a worker is available to process the item, so that the producer cannot outrun the workers.
+// Processing ends once produce returns and all emitted items are processed.
+// The error returned by produce is then returned.
+func DoQueue[T any](produce func(emit func(T)) error, worker func(T), max int) error {
+	var (
+		itemc = make(chan T)
+		errc  = make(chan error, 1)
+		wg    sync.WaitGroup
+	)
+
+	go func() {
+		errc <- produce(func(item T) {
+			itemc <- item
+		})
+		close(itemc)
+	}()
+
+	wg.Add(max)
+	for i := 0; i < max; i++ {
+		go func() {
+			for item := range itemc {
+				worker(item)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	return <-errc
+}
+
+// DoPull spawns max workers pulling their items from next until it reports that there are no more.
+// next is called under a lock, so that it does not need to be safe for concurrent use,
+// while workers run concurrently, e.g. to read from a cursor. It is not called again once it returned false.
+func DoPull[T any](next func() (T, bool), worker func(T), max int) {
+	var (
+		mu   sync.Mutex
+		done bool
+		wg   sync.WaitGroup
+	)
+	pull := func() (T, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !done {
+			item, ok := next()
+			if ok {
+				return item, true
+			}
+			done = true
+		}
+		var zero T
+		return zero, false
+	}
+
+	wg.Add(max)
+	for i := 0; i < max; i++ {
+		go func() {
+			for item, ok := pull(); ok; item, ok = pull() {
+				worker(item)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,92 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoQueue(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu       sync.Mutex
+			results  = make([]int, n)
+			inflight int32
+		)
+		produce := func(emit func(int)) error {
+			for i := 0; i < n; i++ {
+				emit(i)
+				// backpressure: no more items than workers can be in flight
+				if m := atomic.LoadInt32(&inflight); m > 2 {
+					return fmt.Errorf("too many items in flight: %d", m)
+				}
+			}
+			return nil
+		}
+		worker := func(item int) {
+			atomic.AddInt32(&inflight, 1)
+			mu.Lock()
+			results[item] = 1
+			mu.Unlock()
+			atomic.AddInt32(&inflight, -1)
+		}
+		if err := work.DoQueue(produce, worker, 2); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoQueueProducerError(t *testing.T) {
+	produce := func(emit func(int)) error {
+		emit(1)
+		return fmt.Errorf("fail")
+	}
+	var processed int32
+	worker := func(item int) {
+		atomic.AddInt32(&processed, 1)
+	}
+	if err := work.DoQueue(produce, worker, 2); err == nil || err.Error() != "fail" {
+		t.Errorf("expected producer error, got %v", err)
+		t.FailNow()
+	}
+	if processed != 1 {
+		t.Errorf("expected the emitted item to be processed")
+		t.FailNow()
+	}
+}
+
+func TestDoPull(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		// next is not safe for concurrent use
+		i, calls := 0, 0
+		next := func() (int, bool) {
+			calls++
+			if i == n {
+				return 0, false
+			}
+			i++
+			return i - 1, true
+		}
+		worker := func(item int) {
+			results[item] = 1
+		}
+		work.DoPull(next, worker, 4)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		if calls != n+1 {
+			t.Errorf("next called after returning false: %d calls for %d items", calls, n)
+			t.FailNow()
+		}
+	}
+}
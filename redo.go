@@ -0,0 +1,111 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTooManyRedos is returned when the finalizer requests an item to be processed again too many times.
+var ErrTooManyRedos = errors.New("work: too many redos")
+
+// DoWithRedo spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// The finalizer is called on the processed items, in increasing index order,
+// and can request an item to be processed again by returning true:
+// its worker is then run again ahead of the pending items and the finalizer called again on it.
+// An item can be processed again up to redos times, the next request aborts all processing
+// and an error wrapping ErrTooManyRedos with the index of the item is returned.
+func DoWithRedo(n int, worker func(idx int), finalizer func(idx int) (redo bool), redos int) error {
+	return DoNWithRedo(n, worker, finalizer, numRoutines, redos)
+}
+
+// DoNWithRedo spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithRedo.
+func DoNWithRedo(n int, worker func(idx int), finalizer func(idx int) (redo bool), max, redos int) error {
+	var (
+		mu         sync.Mutex
+		cond       = sync.NewCond(&mu)
+		queue      = make([]int, n)    // items waiting for a worker
+		running    int                 // number of running workers
+		unfinished = n                 // number of items not finalized yet
+		redone     = make(map[int]int) // number of redos per item
+		err        error               // first error encountered
+		workc      = make(chan int)    // results from workers
+		wgf        sync.WaitGroup
+	)
+	for i := range queue {
+		queue[i] = i
+	}
+
+	wgf.Add(1)
+	go func() {
+		// buffer holds results that cannot be finalized yet.
+		buffer := make(map[int]struct{})
+		pos := 0
+		for idx := range workc {
+			buffer[idx] = struct{}{}
+			for ; ; pos++ {
+				if _, ok := buffer[pos]; !ok {
+					break
+				}
+				delete(buffer, pos)
+				mu.Lock()
+				failed := err != nil
+				mu.Unlock()
+				if failed {
+					break
+				}
+				redo := finalizer(pos)
+				mu.Lock()
+				switch {
+				case !redo:
+					unfinished--
+				case redone[pos] == redos:
+					err = fmt.Errorf("%w at index %d", ErrTooManyRedos, pos)
+				default:
+					redone[pos]++
+					// the finalizer is waiting for this item: process it first
+					queue = append([]int{pos}, queue...)
+				}
+				cond.Signal()
+				mu.Unlock()
+				if redo {
+					break
+				}
+			}
+		}
+		wgf.Done()
+	}()
+
+	mu.Lock()
+	for {
+		// wait for an item to process, keeping in mind that the finalizer may request a redo
+		for err == nil && (running >= max || len(queue) == 0 && unfinished > 0) {
+			cond.Wait()
+		}
+		if err != nil || unfinished == 0 {
+			break
+		}
+		idx := queue[0]
+		queue = queue[1:]
+		running++
+		go func(idx int) {
+			worker(idx)
+			workc <- idx
+			mu.Lock()
+			running--
+			cond.Signal()
+			mu.Unlock()
+		}(idx)
+	}
+	// wait for workers
+	for running > 0 {
+		cond.Wait()
+	}
+	mu.Unlock()
+
+	close(workc)
+	wgf.Wait()
+
+	return err
+}
@@ -0,0 +1,73 @@
+package work_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithRedo(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu   sync.Mutex
+			runs = make([]int, n)
+		)
+		worker := func(idx int) {
+			mu.Lock()
+			runs[idx]++
+			mu.Unlock()
+		}
+		var final []int
+		// every odd item is redone once
+		finalizer := func(idx int) bool {
+			final = append(final, idx)
+			mu.Lock()
+			defer mu.Unlock()
+			return idx%2 > 0 && runs[idx] == 1
+		}
+		if err := work.DoWithRedo(n, worker, finalizer, 1); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		var expected []int
+		for i := 0; i < n; i++ {
+			expected = append(expected, i)
+			if i%2 > 0 {
+				expected = append(expected, i)
+			}
+			if runs[i] != 1+i%2 {
+				t.Errorf("unexpected runs for index %d: %d", i, runs[i])
+				t.FailNow()
+			}
+		}
+		if len(final) != len(expected) {
+			t.Errorf("unexpected finalized items: got %v expected %v", final, expected)
+			t.FailNow()
+		}
+		for i := range final {
+			if final[i] != expected[i] {
+				t.Errorf("unexpected finalized items: got %v expected %v", final, expected)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoWithRedoTooMany(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		worker := func(idx int) {}
+		finalizer := func(idx int) bool {
+			return idx == n-1
+		}
+		err := work.DoWithRedo(n, worker, finalizer, 2)
+		if !errors.Is(err, work.ErrTooManyRedos) {
+			t.Errorf("expected too many redos, got %v", err)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package work
+
+import (
+	"sync"
+	"time"
+)
+
+// ReduceOption customizes Reduce.
+type ReduceOption[R any] func(*reduceOptions[R])
+
+type reduceOptions[R any] struct {
+	flushInterval time.Duration
+	flush         func(acc R)
+}
+
+// WithFlushInterval calls flush with the current accumulator every d and once the reduction is over.
+// flush is never called concurrently with the reducer, so the accumulator can be used without synchronization.
+// If d is not positive, flush is only called once the reduction is over.
+func WithFlushInterval[R any](d time.Duration, flush func(acc R)) ReduceOption[R] {
+	return func(o *reduceOptions[R]) {
+		o.flushInterval = d
+		o.flush = flush
+	}
+}
+
+// Reduce spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and combines their results with reducef, starting with init.
+// Results are reduced in increasing index order from a single goroutine.
+func Reduce[R any](n int, worker func(idx int) R, init R, reducef func(acc, r R) R, opts ...ReduceOption[R]) R {
+	var o reduceOptions[R]
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		mu      sync.Mutex // protects acc from concurrent flushes
+		acc     = init
+		results = make([]R, n)
+		zero    R
+	)
+
+	if o.flush != nil {
+		// deferred first so that it runs once the periodic flushes are stopped
+		defer func() {
+			o.flush(acc)
+		}()
+	}
+	if o.flush != nil && o.flushInterval > 0 {
+		var (
+			stopc = make(chan struct{})
+			wg    sync.WaitGroup
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(o.flushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					mu.Lock()
+					o.flush(acc)
+					mu.Unlock()
+				case <-stopc:
+					return
+				}
+			}
+		}()
+		defer func() {
+			close(stopc)
+			wg.Wait()
+		}()
+	}
+
+	Do(n, func(idx int) {
+		results[idx] = worker(idx)
+	}, func(idx int) {
+		mu.Lock()
+		acc = reducef(acc, results[idx])
+		mu.Unlock()
+		// release the result as soon as possible
+		results[idx] = zero
+	})
+
+	return acc
+}
+
+// MapFilterReduce spawns workers for each element of in, limiting their numbers by GOMAXPROCS.
+// Each worker maps its element with mapf, which also reports whether the result is to be kept.
+// The kept results are combined with reducef, starting with init,
+// in increasing index order from a single goroutine.
+func MapFilterReduce[T, R any](in []T, mapf func(T) (R, bool), init R, reducef func(acc, r R) R) R {
+	type result struct {
+		r    R
+		keep bool
+	}
+	var (
+		acc     = init
+		results = make([]result, len(in))
+	)
+	Do(len(in), func(idx int) {
+		r, keep := mapf(in[idx])
+		results[idx] = result{r, keep}
+	}, func(idx int) {
+		if res := results[idx]; res.keep {
+			acc = reducef(acc, res.r)
+		}
+		// release the result as soon as possible
+		results[idx] = result{}
+	})
+	return acc
+}
+
+// DoCombine spawns workers with index 0 to n-1 on GOMAXPROCS goroutines and combines their results with combine.
+// Each goroutine combines the results of its own workers, starting with identity,
+// then the partial results of the goroutines are combined pairwise, concurrently, in a tree.
+// Unlike Reduce, results are not combined in index order: combine must be associative and commutative,
+// and identity must be its neutral element, e.g. addition and 0.
+// It returns identity if n is not positive.
+func DoCombine[A any](n int, worker func(idx int) A, combine func(a, b A) A, identity A) A {
+	max := numRoutines
+	if n < max {
+		max = n
+	}
+	if max <= 0 {
+		return identity
+	}
+	partials := make([]A, max)
+	Do(max, func(g int) {
+		acc := identity
+		for idx := g; idx < n; idx += max {
+			acc = combine(acc, worker(idx))
+		}
+		partials[g] = acc
+	}, nil)
+
+	for len(partials) > 1 {
+		half := (len(partials) + 1) / 2
+		next := make([]A, half)
+		Do(half, func(i int) {
+			if j := i + half; j < len(partials) {
+				next[i] = combine(partials[i], partials[j])
+			} else {
+				next[i] = partials[i]
+			}
+		}, nil)
+		partials = next
+	}
+	return partials[0]
+}
+
+// DoPartition splits s into GOMAXPROCS contiguous sub-slices of roughly equal length,
+// runs partial on each of them concurrently and combines the partial results with combine.
+// Partial results are combined in the order of their sub-slices, so combine only needs to be associative.
+// If s is empty, partial is called once with it.
+func DoPartition[T, R any](s []T, partial func(sub []T) R, combine func(a, b R) R) R {
+	return DoNPartition(s, partial, combine, numRoutines)
+}
+
+// DoNPartition splits s into max contiguous sub-slices of roughly equal length.
+// Similar to DoPartition.
+func DoNPartition[T, R any](s []T, partial func(sub []T) R, combine func(a, b R) R, max int) R {
+	if len(s) < max {
+		max = len(s)
+	}
+	if max <= 1 {
+		return partial(s)
+	}
+	partials := make([]R, max)
+	DoN(max, func(g int) {
+		// the first len(s)%max sub-slices get one more item
+		lo := g*(len(s)/max) + min(g, len(s)%max)
+		hi := lo + len(s)/max
+		if g < len(s)%max {
+			hi++
+		}
+		partials[g] = partial(s[lo:hi:hi])
+	}, nil, max)
+
+	acc := partials[0]
+	for _, r := range partials[1:] {
+		acc = combine(acc, r)
+	}
+	return acc
+}
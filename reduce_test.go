@@ -0,0 +1,158 @@
+package work_test
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestReduce(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) []int {
+			return []int{idx}
+		}
+		reducef := func(acc, r []int) []int {
+			return append(acc, r...)
+		}
+		res := work.Reduce(n, worker, nil, reducef)
+		if len(res) != n {
+			t.Errorf("unexpected result size: got %d expected %d", len(res), n)
+			t.FailNow()
+		}
+		for i, v := range res {
+			if v != i {
+				t.Errorf("results reduced out of order: %v", res)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestReduceWithFlushInterval(t *testing.T) {
+	const n = 20
+	var flushes int32
+	last := -1
+	worker := func(idx int) int {
+		time.Sleep(time.Millisecond)
+		return 1
+	}
+	reducef := func(acc, r int) int {
+		return acc + r
+	}
+	flush := func(acc int) {
+		atomic.AddInt32(&flushes, 1)
+		if acc < last {
+			t.Errorf("accumulator went backwards: %d then %d", last, acc)
+		}
+		last = acc
+	}
+	res := work.Reduce(n, worker, 0, reducef, work.WithFlushInterval(time.Millisecond, flush))
+	if res != n {
+		t.Errorf("unexpected result: got %d expected %d", res, n)
+		t.FailNow()
+	}
+	if flushes < 2 {
+		t.Errorf("expected periodic flushes, got %d", flushes)
+		t.FailNow()
+	}
+	if last != n {
+		t.Errorf("unexpected final flush: got %d expected %d", last, n)
+		t.FailNow()
+	}
+}
+
+func TestReduceWithFlushIntervalNotPositive(t *testing.T) {
+	const n = 20
+	var flushed []int
+	flush := func(acc int) {
+		flushed = append(flushed, acc)
+	}
+	res := work.Reduce(n, func(int) int { return 1 }, 0, func(acc, r int) int {
+		return acc + r
+	}, work.WithFlushInterval(0, flush))
+	if res != n {
+		t.Errorf("unexpected result: got %d expected %d", res, n)
+		t.FailNow()
+	}
+	if len(flushed) != 1 || flushed[0] != n {
+		t.Errorf("expected a single final flush, got %v", flushed)
+		t.FailNow()
+	}
+}
+
+func TestMapFilterReduce(t *testing.T) {
+	for _, n := range indexes {
+		in := make([]int, n)
+		for i := range in {
+			in[i] = i
+		}
+		// keep the squares of even numbers
+		mapf := func(v int) (string, bool) {
+			return strconv.Itoa(v * v), v%2 == 0
+		}
+		reducef := func(acc, r string) string {
+			return acc + r + ","
+		}
+		res := work.MapFilterReduce(in, mapf, "", reducef)
+		var expected string
+		for i := 0; i < n; i += 2 {
+			expected += strconv.Itoa(i*i) + ","
+		}
+		if res != expected {
+			t.Errorf("unexpected result: got %q expected %q", res, expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoCombine(t *testing.T) {
+	for _, n := range indexes {
+		sum := work.DoCombine(n, func(idx int) int {
+			return idx
+		}, func(a, b int) int {
+			return a + b
+		}, 0)
+		if expected := n * (n - 1) / 2; sum != expected {
+			t.Errorf("unexpected sum: got %d expected %d", sum, expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoPartition(t *testing.T) {
+	for _, n := range indexes {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i
+		}
+		for _, max := range []int{1, 3, 8} {
+			// concatenating the sub-slices gives back s
+			got := work.DoNPartition(s, func(sub []int) []int {
+				return append([]int(nil), sub...)
+			}, func(a, b []int) []int {
+				return append(a, b...)
+			}, max)
+			if fmt.Sprint(got) != fmt.Sprint(s) {
+				t.Errorf("unexpected partitions: got %v expected %v", got, s)
+				t.FailNow()
+			}
+		}
+		sum := work.DoPartition(s, func(sub []int) int {
+			var sum int
+			for _, x := range sub {
+				sum += x
+			}
+			return sum
+		}, func(a, b int) int {
+			return a + b
+		})
+		if expected := n * (n - 1) / 2; sum != expected {
+			t.Errorf("unexpected sum: got %d expected %d", sum, expected)
+			t.FailNow()
+		}
+	}
+}
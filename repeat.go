@@ -0,0 +1,24 @@
+package work
+
+// Repeat runs f times times concurrently, limiting the number of concurrent runs by GOMAXPROCS,
+// and returns their results, the result of iteration i being at position i.
+func Repeat[R any](times int, f func(iter int) R) []R {
+	res := make([]R, times)
+	Do(times, func(idx int) {
+		res[idx] = f(idx)
+	}, nil)
+	return res
+}
+
+// RepeatErr runs f times times concurrently, limiting the number of concurrent runs by GOMAXPROCS,
+// and returns their results, the result of iteration i being at position i.
+// The first error encountered aborts all processing and is then returned along with the results so far.
+func RepeatErr[R any](times int, f func(iter int) (R, error)) ([]R, error) {
+	res := make([]R, times)
+	err := DoWithError(times, func(idx int) error {
+		r, err := f(idx)
+		res[idx] = r
+		return err
+	}, nil)
+	return res, err
+}
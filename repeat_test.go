@@ -0,0 +1,57 @@
+package work_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestRepeat(t *testing.T) {
+	for _, n := range indexes {
+		res := work.Repeat(n, func(iter int) int {
+			return iter * iter
+		})
+		if len(res) != n {
+			t.Errorf("unexpected results size: got %d expected %d", len(res), n)
+			t.FailNow()
+		}
+		for i, r := range res {
+			if r != i*i {
+				t.Errorf("unexpected result for iteration %d: %d", i, r)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestRepeatErr(t *testing.T) {
+	for _, n := range indexes {
+		res, err := work.RepeatErr(n, func(iter int) (string, error) {
+			return fmt.Sprint(iter), nil
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		for i, r := range res {
+			if r != fmt.Sprint(i) {
+				t.Errorf("unexpected result for iteration %d: %s", i, r)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestRepeatErrFail(t *testing.T) {
+	_, err := work.RepeatErr(8, func(iter int) (int, error) {
+		if iter == 3 {
+			return 0, fmt.Errorf("fail")
+		}
+		return iter, nil
+	})
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected error, got %v", err)
+		t.FailNow()
+	}
+}
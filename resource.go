@@ -0,0 +1,17 @@
+package work
+
+// WorkerWithResource returns a worker for DoWithError and alike that acquires a resource before calling worker with it,
+// e.g. a database connection, and releases it once worker returns, even if it fails or panics.
+// An error returned by acquire is returned as the worker error, worker being then not called.
+// Resources are not pooled: acquire and release are called once per item.
+// Since no more than max workers run at the same time, no more than max resources are held at the same time.
+func WorkerWithResource[T any](acquire func() (T, error), release func(T), worker func(idx int, res T) error) func(idx int) error {
+	return func(idx int) error {
+		res, err := acquire()
+		if err != nil {
+			return err
+		}
+		defer release(res)
+		return worker(idx, res)
+	}
+}
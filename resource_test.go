@@ -0,0 +1,83 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWorkerWithResource(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu       sync.Mutex
+			held     = make(map[int]bool)
+			next     int
+			acquired int
+		)
+		acquire := func() (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			next++
+			acquired++
+			held[next] = true
+			return next, nil
+		}
+		release := func(res int) {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(held, res)
+		}
+		worker := func(idx int, res int) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if !held[res] {
+				t.Errorf("worker %d got a released resource", idx)
+			}
+			if idx%2 > 0 {
+				return fmt.Errorf("fail %d", idx)
+			}
+			return nil
+		}
+		_ = work.DoWithError(n, work.WorkerWithResource(acquire, release, worker), nil, work.WithFailureThreshold(n))
+		if len(held) != 0 {
+			t.Errorf("resources not released: %v", held)
+			t.FailNow()
+		}
+		if acquired != n {
+			t.Errorf("unexpected acquired resources: got %d expected %d", acquired, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestWorkerWithResourceAcquireError(t *testing.T) {
+	acquire := func() (int, error) {
+		return 0, fmt.Errorf("acquire")
+	}
+	release := func(int) {
+		t.Errorf("unexpected release")
+	}
+	worker := func(idx int, res int) error {
+		t.Errorf("unexpected worker call")
+		return nil
+	}
+	err := work.DoWithError(4, work.WorkerWithResource(acquire, release, worker), nil)
+	if err == nil || err.Error() != "acquire" {
+		t.Errorf("expected acquire error, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestWorkerWithResourcePanic(t *testing.T) {
+	var released bool
+	worker := work.WorkerWithResource(func() (int, error) { return 1, nil }, func(int) { released = true }, func(int, int) error {
+		panic("boom")
+	})
+	err := work.DoWithError(1, worker, nil, work.WithPanicConverter(nil))
+	if err == nil || !released {
+		t.Errorf("resource not released on panic: %v", err)
+		t.FailNow()
+	}
+}
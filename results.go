@@ -0,0 +1,19 @@
+package work
+
+// Result holds either the value or the error returned by a worker.
+type Result[R any] struct {
+	Value R
+	Err   error
+}
+
+// DoResults spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// All workers are run regardless of failures.
+// The returned slice has length n and holds the value and error returned by the worker with index i at position i.
+func DoResults[R any](n int, worker func(idx int) (R, error)) []Result[R] {
+	res := make([]Result[R], n)
+	do(n, func(idx int) {
+		v, err := worker(idx)
+		res[idx] = Result[R]{v, err}
+	}, numRoutines)
+	return res
+}
@@ -0,0 +1,37 @@
+package work_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoResults(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) (int, error) {
+			if idx%3 == 1 {
+				return 0, fmt.Errorf("fail %d", idx)
+			}
+			return idx * 2, nil
+		}
+		res := work.DoResults(n, worker)
+		if len(res) != n {
+			t.Errorf("unexpected results size: got %d expected %d", len(res), n)
+			t.FailNow()
+		}
+		for i, r := range res {
+			if i%3 == 1 {
+				if r.Err == nil || r.Err.Error() != fmt.Sprintf("fail %d", i) {
+					t.Errorf("unexpected error at index %d: %v", i, r.Err)
+					t.FailNow()
+				}
+				continue
+			}
+			if r.Err != nil || r.Value != i*2 {
+				t.Errorf("unexpected result at index %d: %+v", i, r)
+				t.FailNow()
+			}
+		}
+	}
+}
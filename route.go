@@ -0,0 +1,59 @@
+package work
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrInvalidSink is returned by DoRoute when a worker returns an invalid sink index.
+var ErrInvalidSink = errors.New("work: invalid sink")
+
+// DoRoute spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Each worker returns a result along with the index of the sink it must be sent to.
+// Every sink runs in its own goroutine and receives its results one at a time, in increasing index order,
+// so that it requires no synchronization. Different sinks run concurrently.
+// If a worker returns an invalid sink index, processing is aborted and an IndexError wrapping ErrInvalidSink
+// is returned, the results of the previous items having been sent to their sinks.
+func DoRoute[R any](n int, worker func(idx int) (R, int), sinks []func(R)) error {
+	type result struct {
+		r    R
+		sink int
+	}
+	var (
+		results = make([]result, n)
+		sinkcs  = make([]chan R, len(sinks))
+		wg      sync.WaitGroup
+	)
+	wg.Add(len(sinks))
+	for i, sink := range sinks {
+		sinkc := make(chan R)
+		sinkcs[i] = sinkc
+		go func(sink func(R)) {
+			for r := range sinkc {
+				sink(r)
+			}
+			wg.Done()
+		}(sink)
+	}
+	defer func() {
+		for _, sinkc := range sinkcs {
+			close(sinkc)
+		}
+		wg.Wait()
+	}()
+
+	return DoWithError(n, func(idx int) error {
+		r, sink := worker(idx)
+		if sink < 0 || sink >= len(sinks) {
+			return IndexError{idx, fmt.Errorf("%w %d", ErrInvalidSink, sink)}
+		}
+		results[idx] = result{r, sink}
+		return nil
+	}, func(idx int) error {
+		res := results[idx]
+		results[idx] = result{}
+		sinkcs[res.sink] <- res.r
+		return nil
+	})
+}
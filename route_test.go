@@ -0,0 +1,67 @@
+package work_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoRoute(t *testing.T) {
+	for _, n := range indexes {
+		var evens, odds []int
+		sinks := []func(int){
+			func(r int) { evens = append(evens, r) },
+			func(r int) { odds = append(odds, r) },
+		}
+		worker := func(idx int) (int, int) {
+			return idx, idx % 2
+		}
+		if err := work.DoRoute(n, worker, sinks); err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if len(evens)+len(odds) != n {
+			t.Errorf("unexpected number of results: %v %v", evens, odds)
+			t.FailNow()
+		}
+		for i, r := range evens {
+			if r != 2*i {
+				t.Errorf("unexpected even results: %v", evens)
+				t.FailNow()
+			}
+		}
+		for i, r := range odds {
+			if r != 2*i+1 {
+				t.Errorf("unexpected odd results: %v", odds)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestDoRouteInvalidSink(t *testing.T) {
+	const n = 8
+	var results []int
+	sinks := []func(int){
+		func(r int) { results = append(results, r) },
+	}
+	worker := func(idx int) (int, int) {
+		if idx == 3 {
+			return idx, 1
+		}
+		return idx, 0
+	}
+	err := work.DoRoute(n, worker, sinks)
+	var ie work.IndexError
+	if !errors.As(err, &ie) || ie.Index != 3 || !errors.Is(err, work.ErrInvalidSink) {
+		t.Errorf("expected invalid sink error at index 3, got %v", err)
+		t.FailNow()
+	}
+	for i, r := range results {
+		if r != i || r >= 3 {
+			t.Errorf("unexpected results: %v", results)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package work
+
+import "sync"
+
+// runtimeMax is the concurrency override set by SetRuntimeMax.
+var runtimeMax struct {
+	mu      sync.Mutex
+	n       int
+	changed chan struct{} // closed when n changes
+}
+
+// SetRuntimeMax limits the number of running workers of each call using WithRuntimeMax to n,
+// on top of its own maximum. A value of n lower than 1 removes the limit.
+// Calls in progress observe the new limit for the workers they start from then on,
+// running workers are not interrupted, e.g. to ramp concurrency up or down without restarting.
+func SetRuntimeMax(n int) {
+	runtimeMax.mu.Lock()
+	runtimeMax.n = n
+	if runtimeMax.changed != nil {
+		close(runtimeMax.changed)
+		runtimeMax.changed = nil
+	}
+	runtimeMax.mu.Unlock()
+}
+
+// loadRuntimeMax returns the current runtime maximum and a channel closed when it changes.
+func loadRuntimeMax() (int, <-chan struct{}) {
+	runtimeMax.mu.Lock()
+	defer runtimeMax.mu.Unlock()
+	if runtimeMax.changed == nil {
+		runtimeMax.changed = make(chan struct{})
+	}
+	return runtimeMax.n, runtimeMax.changed
+}
@@ -0,0 +1,67 @@
+package work_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWithRuntimeMax(t *testing.T) {
+	const max = 2
+	work.SetRuntimeMax(max)
+	defer work.SetRuntimeMax(0)
+
+	var running, peak int32
+	worker := func(idx int) {
+		r := atomic.AddInt32(&running, 1)
+		for p := atomic.LoadInt32(&peak); r > p; p = atomic.LoadInt32(&peak) {
+			if atomic.CompareAndSwapInt32(&peak, p, r) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}
+	work.DoN(20, worker, nil, 8, work.WithRuntimeMax())
+	if peak > max {
+		t.Errorf("runtime max exceeded: got %d expected at most %d", peak, max)
+		t.FailNow()
+	}
+}
+
+func TestSetRuntimeMaxInFlight(t *testing.T) {
+	work.SetRuntimeMax(1)
+	defer work.SetRuntimeMax(0)
+
+	var running int32
+	both := make(chan struct{})
+	worker := func(idx int) error {
+		if atomic.AddInt32(&running, 1) == 2 {
+			close(both)
+		}
+		// the workers can only complete once they run at the same time
+		select {
+		case <-both:
+			return nil
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("timeout")
+		}
+	}
+	errc := make(chan error)
+	go func() {
+		errc <- work.DoNWithError(2, worker, nil, 2, work.WithRuntimeMax())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if r := atomic.LoadInt32(&running); r != 1 {
+		t.Errorf("unexpected running workers: got %d expected 1", r)
+		t.FailNow()
+	}
+	work.SetRuntimeMax(2)
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,60 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ErrSignaled is returned when processing is aborted by a signal.
+var ErrSignaled = errors.New("work: aborted by signal")
+
+// DoSignals spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// until one of sigs is received, e.g. os.Interrupt for a command line tool.
+// Processing is then aborted and ErrSignaled is returned: no more workers are started
+// and the finalizer is still called on the items whose worker completed, in order,
+// up to the first one that was not processed.
+// ErrSignaled is returned even if the signal was received once all workers were started.
+// The signals are only relayed to the package while the call is in progress,
+// their previous handling being restored once it returns.
+// If sigs is empty, it defaults to os.Interrupt and syscall.SIGTERM instead of all signals.
+func DoSignals(sigs []os.Signal, n int, worker, finalizer func(idx int)) error {
+	if len(sigs) == 0 {
+		// relaying all signals would include the ones used by the runtime, e.g. for preemption
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, sigs...)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		signaled bool
+		donec    = make(chan struct{})
+	)
+	go func() {
+		defer close(donec)
+		select {
+		case <-sigc:
+			signaled = true
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := DoNWithContext(ctx, n, withoutError(worker), finalizerWithoutError(finalizer), numRoutines)
+	// once Stop returns, the signals received so far were delivered to sigc
+	signal.Stop(sigc)
+	cancel()
+	<-donec
+	select {
+	case <-sigc:
+		signaled = true
+	default:
+	}
+	if signaled {
+		// also reported if received once all workers were started, since it was not handled otherwise
+		return ErrSignaled
+	}
+	return err
+}
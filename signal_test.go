@@ -0,0 +1,125 @@
+//go:build unix
+
+package work_test
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoSignals(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) {
+			results[idx] = 1
+		}
+		err := work.DoSignals([]os.Signal{syscall.SIGUSR1}, n, worker, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoSignalsInterrupted(t *testing.T) {
+	const n = 100
+	// observe the delivery of the signal independently of the call
+	seen := make(chan os.Signal, 1)
+	signal.Notify(seen, syscall.SIGUSR1)
+	defer signal.Stop(seen)
+
+	var (
+		mu        sync.Mutex
+		completed = make([]bool, n)
+		delivered = make(chan struct{})
+	)
+	worker := func(idx int) {
+		if idx == 0 {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			<-seen
+			close(delivered)
+		}
+		// hold the workers until the signal was delivered, however many of them run
+		<-delivered
+		mu.Lock()
+		completed[idx] = true
+		mu.Unlock()
+	}
+	var final []int
+	finalizer := func(idx int) {
+		final = append(final, idx)
+	}
+	err := work.DoSignals([]os.Signal{syscall.SIGUSR1}, n, worker, finalizer)
+	if err != work.ErrSignaled {
+		t.Errorf("expected ErrSignaled, got %v", err)
+		t.FailNow()
+	}
+	var prefix []int
+	for i, ok := range completed {
+		if !ok {
+			break
+		}
+		prefix = append(prefix, i)
+	}
+	if fmt.Sprint(final) != fmt.Sprint(prefix) {
+		t.Errorf("unexpected finalized items: got %v expected %v", final, prefix)
+		t.FailNow()
+	}
+}
+
+func TestDoSignalsLate(t *testing.T) {
+	seen := make(chan os.Signal, 1)
+	signal.Notify(seen, syscall.SIGUSR1)
+	defer signal.Stop(seen)
+
+	const n = 4
+	// the signal is received once all workers were started
+	err := work.DoSignals([]os.Signal{syscall.SIGUSR1}, n, func(int) {}, func(idx int) {
+		if idx == n-1 {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+			<-seen
+		}
+	})
+	if err != work.ErrSignaled {
+		t.Errorf("expected ErrSignaled, got %v", err)
+		t.FailNow()
+	}
+}
+
+func TestDoSignalsDefault(t *testing.T) {
+	// CPU bound workers get preempted by the runtime using signals
+	const n = 8
+	err := work.DoSignals(nil, n, func(int) {
+		spin(20 * time.Millisecond)
+	}, nil)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+
+	seen := make(chan os.Signal, 1)
+	signal.Notify(seen, syscall.SIGTERM)
+	defer signal.Stop(seen)
+
+	err = work.DoSignals(nil, n, func(idx int) {
+		if idx == 0 {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+			<-seen
+		}
+	}, nil)
+	if err != work.ErrSignaled {
+		t.Errorf("expected ErrSignaled, got %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,95 @@
+package work
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errFlightPanicked is returned to the workers waiting for a shared one that panicked.
+var errFlightPanicked = errors.New("work: shared worker panicked")
+
+// flights holds the workers running with WithSingleflight and WorkerWithSingleflight, for all the calls.
+var flights = &singleflight{calls: make(map[string]*flight)}
+
+// singleflight deduplicates the workers running for the same key.
+type singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a worker running for a key, shared with the workers of the same key.
+type flight struct {
+	done      chan struct{} // closed once the worker returned
+	val       any
+	err       error
+	abandoned bool // the worker returned early because its own context was cancelled
+}
+
+// do runs fn for key unless it is already running, in which case it waits for it to return
+// and returns its value and error instead, or ctx is cancelled.
+// If the running fn returns early because its own context was cancelled, fn is run again
+// by one of the waiting callers.
+func (sf *singleflight) do(ctx context.Context, key string, fn func() (any, error)) (any, error) {
+	for {
+		sf.mu.Lock()
+		f, ok := sf.calls[key]
+		if !ok {
+			break
+		}
+		sf.mu.Unlock()
+		select {
+		case <-f.done:
+			if !f.abandoned {
+				return f.val, f.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &flight{done: make(chan struct{}), err: errFlightPanicked}
+	sf.calls[key] = f
+	sf.mu.Unlock()
+
+	defer func() {
+		sf.mu.Lock()
+		delete(sf.calls, key)
+		sf.mu.Unlock()
+		close(f.done)
+	}()
+	f.val, f.err = fn()
+	if err := ctx.Err(); err != nil && errors.Is(f.err, err) {
+		// the error does not apply to the waiting callers
+		f.abandoned = true
+	}
+	return f.val, f.err
+}
+
+// shared returns a worker running worker through flights with the key returned by keyOf.
+func shared(worker func(ctx context.Context, idx int) error, keyOf func(idx int) string) func(ctx context.Context, idx int) error {
+	return func(ctx context.Context, idx int) error {
+		_, err := flights.do(ctx, keyOf(idx), func() (any, error) {
+			return nil, worker(ctx, idx)
+		})
+		return err
+	}
+}
+
+// WorkerWithSingleflight returns a worker for DoWithError and alike that computes the value of an item
+// with worker and passes it to use, unless a worker for the same key, as returned by keyOf, is already running,
+// in this call or any other one using WithSingleflight or WorkerWithSingleflight: it then waits for that worker
+// to return and gets its value and error instead, e.g. so that an expensive result is only computed once.
+// use is only called if worker succeeded. Keys are shared by all calls and should be namespaced accordingly.
+func WorkerWithSingleflight[R any](keyOf func(idx int) string, worker func(idx int) (R, error), use func(idx int, r R)) func(idx int) error {
+	return func(idx int) error {
+		v, err := flights.do(context.Background(), keyOf(idx), func() (any, error) {
+			return worker(idx)
+		})
+		if err != nil {
+			return err
+		}
+		r, _ := v.(R)
+		use(idx, r)
+		return nil
+	}
+}
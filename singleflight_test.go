@@ -0,0 +1,59 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestWorkerWithSingleflight(t *testing.T) {
+	const n = 8
+	var (
+		runs    int32
+		keys    int32
+		entered = make(chan struct{})
+	)
+	keyOf := func(idx int) string {
+		if atomic.AddInt32(&keys, 1) == 2*n {
+			close(entered)
+		}
+		return "TestWorkerWithSingleflight"
+	}
+	worker := func(idx int) (int, error) {
+		atomic.AddInt32(&runs, 1)
+		// wait for all the workers of both calls to join
+		<-entered
+		return 42, nil
+	}
+	var wg sync.WaitGroup
+	results := make([][]int, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		results[i] = make([]int, n)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = work.DoNWithError(n, work.WorkerWithSingleflight(keyOf, worker, func(idx int, r int) {
+				results[i][idx] = r
+			}), nil, n)
+		}(i)
+	}
+	wg.Wait()
+	if runs != 1 {
+		t.Errorf("unexpected number of runs: got %d expected 1", runs)
+		t.FailNow()
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if s := fmt.Sprint(results[i]); s != "[42 42 42 42 42 42 42 42]" {
+			t.Errorf("unexpected shared results: %v", s)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package work
+
+// DoSlots spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Each worker also receives a slot in [0, GOMAXPROCS) that no other worker uses while it runs,
+// so that per slot state, e.g. scratch buffers in a slice of GOMAXPROCS items,
+// can be used by the worker without synchronization.
+// Recording the slot of each index helps finding out which workers ran concurrently.
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+func DoSlots(n int, worker func(idx, slot int), finalizer func(idx int), opts ...Option) {
+	DoNSlots(n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNSlots spawns workers with index 0 to n-1, limiting their numbers by max.
+// Slots are in [0, max).
+// Similar to DoSlots.
+func DoNSlots(n int, worker func(idx, slot int), finalizer func(idx int), max int, opts ...Option) {
+	if max <= 0 {
+		return
+	}
+	// as at most max workers run at the same time, a slot is always free when a worker starts
+	slots := make(chan int, max)
+	for i := 0; i < max; i++ {
+		slots <- i
+	}
+	DoN(n, func(idx int) {
+		slot := <-slots
+		worker(idx, slot)
+		slots <- slot
+	}, finalizer, max, opts...)
+}
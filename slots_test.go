@@ -0,0 +1,51 @@
+package work_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoSlots(t *testing.T) {
+	const max = 4
+	for _, n := range indexes {
+		var (
+			inUse   [max]int32
+			shared  int32
+			results = make([]int, n)
+		)
+		worker := func(idx, slot int) {
+			if slot < 0 || slot >= max {
+				atomic.StoreInt32(&shared, 1)
+				return
+			}
+			if !atomic.CompareAndSwapInt32(&inUse[slot], 0, 1) {
+				atomic.StoreInt32(&shared, 1)
+				return
+			}
+			time.Sleep(10 * time.Microsecond)
+			results[idx] = 1
+			atomic.StoreInt32(&inUse[slot], 0)
+		}
+		var final []int
+		work.DoNSlots(n, worker, func(idx int) {
+			final = append(final, idx)
+		}, max)
+		if shared != 0 {
+			t.Errorf("slot out of range or used by concurrent workers")
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i, idx := range final {
+			if i != idx {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package work
+
+import "sort"
+
+// DoSorted spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Once all workers are done, their results are sorted according to less
+// and finalizer is called on each of them in that order.
+// Unlike the index ordering of Do, no result can be finalized before all of them are available.
+func DoSorted[R any](n int, worker func(idx int) R, less func(a, b R) bool, finalizer func(R)) {
+	results := make([]R, n)
+	Do(n, func(idx int) {
+		results[idx] = worker(idx)
+	}, nil)
+	sort.SliceStable(results, func(i, j int) bool {
+		return less(results[i], results[j])
+	})
+	for _, r := range results {
+		finalizer(r)
+	}
+}
@@ -0,0 +1,34 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoSorted(t *testing.T) {
+	for _, n := range indexes {
+		// results in decreasing order of their index
+		worker := func(idx int) int {
+			return n - idx
+		}
+		less := func(a, b int) bool {
+			return a < b
+		}
+		var final []int
+		finalizer := func(r int) {
+			final = append(final, r)
+		}
+		work.DoSorted(n, worker, less, finalizer)
+		if len(final) != n {
+			t.Errorf("unexpected final size: got %d expected %d", len(final), n)
+			t.FailNow()
+		}
+		for i, r := range final {
+			if r != i+1 {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package work
+
+import (
+	"context"
+	"sync"
+)
+
+// DoSparse spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and returns the results of the workers that ran, by index.
+// It is meant for sparse batches, where most items are not run, e.g. because of WithSkip:
+// only the results of the items that ran are allocated.
+// For dense batches, a slice of length n indexed by item, as returned by DoResults, is cheaper.
+// Iterate over slices.Sorted(maps.Keys(res)) to go through the results in increasing index order.
+func DoSparse[R any](n int, worker func(idx int) R, opts ...Option) map[int]R {
+	return DoNSparse(n, worker, numRoutines, opts...)
+}
+
+// DoNSparse spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoSparse.
+func DoNSparse[R any](n int, worker func(idx int) R, max int, opts ...Option) map[int]R {
+	var (
+		mu  sync.Mutex
+		res = make(map[int]R)
+	)
+	b := newBatch(context.Background(), n, func(_ context.Context, idx int) error {
+		r := worker(idx)
+		mu.Lock()
+		res[idx] = r
+		mu.Unlock()
+		return nil
+	}, nil, max, opts)
+	b.run()
+	return res
+}
@@ -0,0 +1,27 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoSparse(t *testing.T) {
+	for _, n := range indexes {
+		// only every tenth item is run
+		skip := func(idx int) bool { return idx%10 != 0 }
+		res := work.DoSparse(n, func(idx int) int {
+			return 2 * idx
+		}, work.WithSkip(skip, false))
+		if expected := (n + 9) / 10; len(res) != expected {
+			t.Errorf("unexpected results size: got %d expected %d", len(res), expected)
+			t.FailNow()
+		}
+		for idx, r := range res {
+			if skip(idx) || r != 2*idx {
+				t.Errorf("unexpected result for index %d: %d", idx, r)
+				t.FailNow()
+			}
+		}
+	}
+}
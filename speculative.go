@@ -0,0 +1,89 @@
+package work
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minSpeculativeSamples is the number of worker durations to observe before speculating.
+const minSpeculativeSamples = 8
+
+// speculation tracks the durations of the workers for WithSpeculative.
+type speculation struct {
+	mu        sync.Mutex
+	samples   []time.Duration
+	threshold time.Duration // duration after which a backup worker is started
+	next      int           // number of samples at which the threshold is computed again
+}
+
+// observe records the duration of a successful worker.
+// The threshold is only computed again when the number of samples doubled, to keep it cheap.
+func (s *speculation) observe(d time.Duration, p float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples = append(s.samples, d)
+	if len(s.samples) < minSpeculativeSamples || len(s.samples) < s.next {
+		return
+	}
+	sorted := append([]time.Duration(nil), s.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.threshold = sorted[int(float64(len(sorted)-1)*p/100)]
+	s.next = 2 * len(s.samples)
+}
+
+// after returns the duration after which a backup worker is started, false if not known yet.
+func (s *speculation) after() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.threshold, s.next > 0
+}
+
+// speculate runs the worker for idx and, if it is still running past the threshold of WithSpeculative,
+// a backup worker for the same item. The result of the first one to return is used:
+// the other one is then cancelled and waited for.
+func (b *Batch) speculate(ctx context.Context, idx int) (panicked bool, err error) {
+	type result struct {
+		panicked bool
+		err      error
+	}
+	resc := make(chan result, 2)
+	var cancels []context.CancelFunc
+	start := func() {
+		ctx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func() {
+			panicked, err := b.call(ctx, idx)
+			resc <- result{panicked, err}
+		}()
+	}
+
+	begin := b.clock.Now()
+	start()
+	var timerc <-chan time.Time
+	if d, ok := b.spec.after(); ok {
+		t := b.clock.NewTimer(d)
+		defer t.Stop()
+		timerc = t.C()
+	}
+	for done := false; !done; {
+		select {
+		case <-timerc:
+			timerc = nil
+			start()
+		case r := <-resc:
+			panicked, err, done = r.panicked, r.err, true
+		}
+	}
+	if err == nil {
+		b.spec.observe(b.clock.Now().Sub(begin), b.speculative)
+	}
+	for _, cancel := range cancels {
+		cancel()
+	}
+	for i := 1; i < len(cancels); i++ {
+		<-resc
+	}
+	return panicked, err
+}
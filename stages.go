@@ -0,0 +1,152 @@
+package work
+
+import "sync"
+
+// Stage is a processing step of DoStages.
+type Stage struct {
+	// Worker processes the item with index idx for this stage.
+	Worker func(idx int)
+	// Max limits the number of concurrent workers of this stage.
+	Max int
+}
+
+// StageWithError is a processing step of DoStagesWithError.
+type StageWithError struct {
+	// Worker processes the item with index idx for this stage.
+	Worker func(idx int) error
+	// Max limits the number of concurrent workers of this stage.
+	Max int
+}
+
+// DoStages spawns workers with index 0 to n-1 for each stage in turn,
+// limiting their numbers by the Max of their stage.
+// An item is handed over to the next stage once it has completed the current one,
+// in increasing index order, so that stages overlap.
+func DoStages(n int, stages []Stage) {
+	estages := make([]StageWithError, len(stages))
+	for i, s := range stages {
+		worker := s.Worker
+		estages[i] = StageWithError{
+			Worker: func(idx int) error {
+				worker(idx)
+				return nil
+			},
+			Max: s.Max,
+		}
+	}
+	DoStagesWithError(n, estages)
+}
+
+// DoStagesWithError spawns workers with index 0 to n-1 for each stage in turn,
+// limiting their numbers by the Max of their stage.
+// Similar to DoStages but with error handling.
+// The first error encountered in any stage stops all the stages from dispatching new workers,
+// including the ones upstream, and is then returned once the running workers are done.
+func DoStagesWithError(n int, stages []StageWithError) error {
+	if len(stages) == 0 {
+		return nil
+	}
+
+	var (
+		p  pipeline
+		in = make(chan int)
+		wg sync.WaitGroup
+	)
+	go func(in chan<- int) {
+		for i := 0; i < n && !p.failed(); i++ {
+			in <- i
+		}
+		close(in)
+	}(in)
+	for _, s := range stages {
+		out := make(chan int)
+		wg.Add(1)
+		go func(s StageWithError, in <-chan int, out chan<- int) {
+			p.runStage(s, in, out)
+			wg.Done()
+		}(s, in, out)
+		in = out
+	}
+	// the last stage has nowhere to hand its items over to
+	for range in {
+	}
+	wg.Wait()
+
+	return p.err
+}
+
+// pipeline holds the state shared by the stages of DoStagesWithError.
+type pipeline struct {
+	mu  sync.Mutex
+	err error // first error encountered
+}
+
+func (p *pipeline) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+}
+
+func (p *pipeline) failed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+// runStage processes the items received from in with the stage worker
+// and sends them to out in increasing index order.
+// It closes out once in is closed and all its items are processed.
+// Once the pipeline has failed, items received from in are discarded.
+func (p *pipeline) runStage(s StageWithError, in <-chan int, out chan<- int) {
+	var (
+		donec   = make(chan struct{}, s.Max) // worker throttling
+		workc   = make(chan int)             // results from workers
+		wg, wgf sync.WaitGroup
+	)
+
+	// initialize the go routine handing over the items in order
+	wgf.Add(1)
+	go func() {
+		// buffer holds items that cannot be handed over yet.
+		buffer := make(map[int]struct{})
+		pos := 0
+		for idx := range workc {
+			buffer[idx] = struct{}{}
+			for ; !p.failed(); pos++ {
+				if _, ok := buffer[pos]; !ok {
+					break
+				}
+				delete(buffer, pos)
+				out <- pos
+			}
+		}
+		close(out)
+		wgf.Done()
+	}()
+
+	for idx := range in {
+		// throttling
+		donec <- struct{}{}
+		if p.failed() {
+			// keep the upstream stages from blocking
+			<-donec
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			if err := s.Worker(idx); err != nil {
+				p.fail(err)
+			} else {
+				workc <- idx
+			}
+			<-donec
+			wg.Done()
+		}(idx)
+	}
+
+	wg.Wait()
+	close(workc)
+	wgf.Wait()
+}
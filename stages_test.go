@@ -0,0 +1,81 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoStages(t *testing.T) {
+	for _, n := range indexes {
+		var (
+			mu      sync.Mutex
+			seen    = make([]int, n) // number of stages completed per item
+			running [2]int32
+			peak    [2]int32
+		)
+		stage := func(s int) func(int) {
+			return func(idx int) {
+				r := atomic.AddInt32(&running[s], 1)
+				mu.Lock()
+				if seen[idx] != s {
+					t.Errorf("item %d entered stage %d after %d stages", idx, s, seen[idx])
+				}
+				seen[idx]++
+				if r > peak[s] {
+					peak[s] = r
+				}
+				mu.Unlock()
+				atomic.AddInt32(&running[s], -1)
+			}
+		}
+		work.DoStages(n, []work.Stage{
+			{Worker: stage(0), Max: 1},
+			{Worker: stage(1), Max: 3},
+		})
+		for i, s := range seen {
+			if s != 2 {
+				t.Errorf("item %d went through %d stages", i, s)
+				t.FailNow()
+			}
+		}
+		if peak[0] > 1 || peak[1] > 3 {
+			t.Errorf("stage limits exceeded: %v", peak)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoStagesWithError(t *testing.T) {
+	const n = 100
+	var first, last int32
+	err := work.DoStagesWithError(n, []work.StageWithError{
+		{Worker: func(idx int) error {
+			atomic.AddInt32(&first, 1)
+			return nil
+		}, Max: 1},
+		{Worker: func(idx int) error {
+			atomic.AddInt32(&last, 1)
+			if idx == 2 {
+				return fmt.Errorf("fail")
+			}
+			return nil
+		}, Max: 1},
+	})
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected stage error, got %v", err)
+		t.FailNow()
+	}
+	// the upstream stage stopped dispatching new items
+	if m := atomic.LoadInt32(&first); m == n {
+		t.Errorf("upstream stage processed all items despite the error")
+		t.FailNow()
+	}
+	if m := atomic.LoadInt32(&last); m != 3 {
+		t.Errorf("unexpected number of items in the last stage: got %d expected 3", m)
+		t.FailNow()
+	}
+}
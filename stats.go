@@ -0,0 +1,149 @@
+package work
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds diagnostics about a call.
+type Stats struct {
+	// MaxBufferLen is the largest number of items whose worker completed
+	// but that were waiting for the finalizer at the same time.
+	// When it approaches n, the finalizer cannot keep up with the workers.
+	MaxBufferLen int
+}
+
+// DoWithStats spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithError but it also returns diagnostics about the processing.
+func DoWithStats(n int, worker func(idx int) error, finalizer func(idx int) error, opts ...Option) (Stats, error) {
+	return DoNWithStats(n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNWithStats spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithStats.
+func DoNWithStats(n int, worker func(idx int) error, finalizer func(idx int) error, max int, opts ...Option) (Stats, error) {
+	b := newBatch(context.Background(), n, withoutContext(worker), finalizer, max, opts)
+	b.run()
+	return Stats{MaxBufferLen: b.peak}, b.err
+}
+
+// reservoirSize is the number of durations sampled by DoTimingSummary.
+const reservoirSize = 1024
+
+// TimingStats summarizes the durations of the workers of a call.
+// Percentiles are computed over a uniform sample of at most 1024 durations, Max over all of them.
+type TimingStats struct {
+	Count         int // number of workers that ran
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+// DoTimingSummary spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithError but it also returns the percentiles of the durations of the workers,
+// using a bounded amount of memory regardless of n.
+func DoTimingSummary(n int, worker func(idx int) error, finalizer func(idx int) error, opts ...Option) (TimingStats, error) {
+	return DoNTimingSummary(n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNTimingSummary spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoTimingSummary.
+func DoNTimingSummary(n int, worker func(idx int) error, finalizer func(idx int) error, max int, opts ...Option) (TimingStats, error) {
+	var (
+		mu     sync.Mutex
+		stats  TimingStats
+		sample = make([]time.Duration, 0, reservoirSize)
+		rnd    = rand.New(rand.NewSource(1))
+	)
+	b := newBatch(context.Background(), n, func(_ context.Context, idx int) error {
+		start := time.Now()
+		err := worker(idx)
+		d := time.Since(start)
+
+		mu.Lock()
+		defer mu.Unlock()
+		stats.Count++
+		if d > stats.Max {
+			stats.Max = d
+		}
+		if len(sample) < reservoirSize {
+			sample = append(sample, d)
+		} else if i := rnd.Intn(stats.Count); i < reservoirSize {
+			sample[i] = d
+		}
+		return err
+	}, finalizer, max, opts)
+	b.run()
+
+	if len(sample) > 0 {
+		sort.Slice(sample, func(i, j int) bool { return sample[i] < sample[j] })
+		percentile := func(p int) time.Duration {
+			return sample[(len(sample)-1)*p/100]
+		}
+		stats.P50, stats.P90, stats.P99 = percentile(50), percentile(90), percentile(99)
+	}
+	return stats, b.err
+}
+
+// IndexDuration records how long the worker for the item with index Index ran.
+type IndexDuration struct {
+	Index    int
+	Duration time.Duration
+}
+
+// durationHeap is a min-heap of durations.
+type durationHeap []IndexDuration
+
+func (h durationHeap) Len() int           { return len(h) }
+func (h durationHeap) Less(i, j int) bool { return h[i].Duration < h[j].Duration }
+func (h durationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *durationHeap) Push(x any)        { *h = append(*h, x.(IndexDuration)) }
+func (h *durationHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// DoSlowest spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS,
+// and returns the k workers that ran the longest, by decreasing duration.
+// It uses an amount of memory proportional to k regardless of n.
+func DoSlowest(n, k int, worker func(idx int)) []IndexDuration {
+	if k <= 0 {
+		Do(n, worker, nil)
+		return nil
+	}
+	var (
+		mu      sync.Mutex
+		slowest = make(durationHeap, 0, k)
+		floor   atomic.Int64 // shortest duration kept once k are, checked without locking
+	)
+	floor.Store(-1)
+	Do(n, func(idx int) {
+		start := time.Now()
+		worker(idx)
+		d := time.Since(start)
+		if int64(d) <= floor.Load() {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(slowest) < k {
+			heap.Push(&slowest, IndexDuration{idx, d})
+		} else if d > slowest[0].Duration {
+			slowest[0] = IndexDuration{idx, d}
+			heap.Fix(&slowest, 0)
+		}
+		if len(slowest) == k {
+			floor.Store(int64(slowest[0].Duration))
+		}
+	}, nil)
+
+	sort.Slice(slowest, func(i, j int) bool { return slowest[i].Duration > slowest[j].Duration })
+	return slowest
+}
@@ -0,0 +1,105 @@
+package work_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithStats(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		// one item at a time never waits for the finalizer
+		stats, err := work.DoNWithStats(n, func(int) error { return nil }, func(int) error { return nil }, 1)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if stats.MaxBufferLen != 1 {
+			t.Errorf("unexpected max buffer length: got %d expected 1", stats.MaxBufferLen)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithStatsLag(t *testing.T) {
+	for _, n := range indexes {
+		if n < 2 {
+			continue
+		}
+		// item 0 completes last, the others wait for it
+		worker := func(idx int) error {
+			if idx == 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nil
+		}
+		stats, err := work.DoNWithStats(n, worker, func(int) error { return nil }, n)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if stats.MaxBufferLen != n {
+			t.Errorf("unexpected max buffer length: got %d expected %d", stats.MaxBufferLen, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoTimingSummary(t *testing.T) {
+	for _, n := range indexes {
+		// durations grow with the index
+		worker := func(idx int) error {
+			time.Sleep(time.Duration(idx) * 100 * time.Microsecond)
+			return nil
+		}
+		stats, err := work.DoTimingSummary(n, worker, nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if stats.Count != n {
+			t.Errorf("unexpected count: got %d expected %d", stats.Count, n)
+			t.FailNow()
+		}
+		if n == 0 {
+			continue
+		}
+		if !(stats.P50 <= stats.P90 && stats.P90 <= stats.P99 && stats.P99 <= stats.Max) {
+			t.Errorf("unordered percentiles: %+v", stats)
+			t.FailNow()
+		}
+		if min := time.Duration(n-1) * 100 * time.Microsecond; stats.Max < min {
+			t.Errorf("unexpected max: got %v expected at least %v", stats.Max, min)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoSlowest(t *testing.T) {
+	const k = 3
+	for _, n := range indexes {
+		// durations grow with the index
+		worker := func(idx int) {
+			time.Sleep(time.Duration(idx) * 2 * time.Millisecond)
+		}
+		slowest := work.DoSlowest(n, k, worker)
+		expected := k
+		if n < k {
+			expected = n
+		}
+		if len(slowest) != expected {
+			t.Errorf("unexpected number of items: got %d expected %d", len(slowest), expected)
+			t.FailNow()
+		}
+		for i, s := range slowest {
+			if s.Index != n-1-i {
+				t.Errorf("unexpected slowest items: %v", slowest)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package work
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopped is returned when processing is stopped by its stop channel.
+var ErrStopped = errors.New("work: stopped")
+
+// DoWithStop spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithContext but processing is aborted as soon as stop is closed or receives a value,
+// in which case ErrStopped is returned.
+// The finalizer is then still called on the items whose worker completed, in order,
+// up to the first one that was not processed, before returning.
+func DoWithStop(stop <-chan struct{}, n int, worker func(idx int) error, finalizer func(idx int) error, opts ...Option) error {
+	return DoNWithStop(stop, n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNWithStop spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithStop.
+func DoNWithStop(stop <-chan struct{}, n int, worker func(idx int) error, finalizer func(idx int) error, max int, opts ...Option) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// ctx is only cancelled by stop until the call returns
+	err := DoNWithContext(ctx, n, withoutContext(worker), finalizer, max, opts...)
+	if ae, ok := err.(*AbortError); ok && ae.Cause == CauseCanceled {
+		ae.Err = ErrStopped
+		return ae
+	}
+	if err != nil && err == ctx.Err() {
+		return ErrStopped
+	}
+	return err
+}
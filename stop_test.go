@@ -0,0 +1,90 @@
+package work_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithStop(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int) error {
+			results[idx] = 1
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			final = append(final, idx)
+			return nil
+		}
+		err := work.DoWithStop(make(chan struct{}), n, worker, finalizer)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		if len(final) != n {
+			t.Errorf("unexpected finalized items: %v", final)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithStopStopped(t *testing.T) {
+	const n = 8
+	var (
+		mu        sync.Mutex
+		completed = make([]bool, n)
+	)
+	stop := make(chan struct{})
+	worker := func(idx int) error {
+		mu.Lock()
+		completed[idx] = true
+		mu.Unlock()
+		return nil
+	}
+	var final []int
+	// a slow finalizer lets results pile up before stopping
+	finalizer := func(idx int) error {
+		time.Sleep(time.Millisecond)
+		if idx == 1 {
+			close(stop)
+		}
+		final = append(final, idx)
+		return nil
+	}
+	err := work.DoNWithStop(stop, n, worker, finalizer, 2)
+	var prefix []int
+	for i, ok := range completed {
+		if !ok {
+			break
+		}
+		prefix = append(prefix, i)
+	}
+	if len(prefix) < n && err != work.ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+		t.FailNow()
+	}
+	if fmt.Sprint(final) != fmt.Sprint(prefix) {
+		t.Errorf("unexpected finalized items: got %v expected %v", final, prefix)
+		t.FailNow()
+	}
+}
+
+func TestDoWithStopWorkerError(t *testing.T) {
+	worker := func(idx int) error {
+		return fmt.Errorf("fail")
+	}
+	err := work.DoWithStop(make(chan struct{}), 4, worker, nil)
+	if err == nil || err.Error() != "fail" {
+		t.Errorf("expected worker error, got %v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,140 @@
+package work
+
+import (
+	"context"
+	"sync"
+)
+
+// Stream spawns workers with index 0 to n-1 in the background, limiting their numbers by GOMAXPROCS,
+// and sends their results to the returned channel in increasing index order.
+// The channel is closed once all results were sent or ctx is cancelled.
+// A consumer stopping early must cancel ctx: no more workers are then started
+// and the background goroutines exit without waiting for their results to be received.
+// With WithDropOldest, the results are buffered in a ring overwriting the oldest ones,
+// so that a slow consumer never holds back the workers.
+func Stream[R any](ctx context.Context, n int, worker func(idx int) R, opts ...Option) <-chan R {
+	var (
+		res  = make([]R, n)
+		out  = make(chan R)
+		send func(r R) error
+		rg   *ring[R]
+	)
+	if o := newOptions(opts); o.dropOldest > 0 {
+		rg = newRing[R](o.dropOldest)
+		send = func(r R) error {
+			rg.push(r)
+			return nil
+		}
+	} else {
+		send = func(r R) error {
+			select {
+			case out <- r:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	b := StartN(ctx, n, func(_ context.Context, idx int) error {
+		res[idx] = worker(idx)
+		return nil
+	}, func(idx int) error {
+		r := res[idx]
+		var zero R
+		res[idx] = zero
+		return send(r)
+	}, numRoutines, opts...)
+
+	if rg == nil {
+		go func() {
+			b.Wait()
+			close(out)
+		}()
+		return out
+	}
+	go func() {
+		b.Wait()
+		rg.close()
+	}()
+	go func() {
+		defer close(out)
+		for {
+			r, ok, done := rg.pop()
+			switch {
+			case done:
+				return
+			case !ok:
+				select {
+				case <-rg.notify:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ring is a fixed size FIFO buffer overwriting its oldest items when full, used by WithDropOldest.
+type ring[R any] struct {
+	mu     sync.Mutex
+	buf    []R
+	start  int // position of the oldest item
+	len    int // number of items
+	closed bool
+	notify chan struct{} // signaled when an item is pushed or the ring closed
+}
+
+func newRing[R any](size int) *ring[R] {
+	return &ring[R]{buf: make([]R, size), notify: make(chan struct{}, 1)}
+}
+
+// push adds r to the ring, overwriting the oldest item if it is full.
+func (rg *ring[R]) push(r R) {
+	rg.mu.Lock()
+	if rg.len == len(rg.buf) {
+		rg.buf[rg.start] = r
+		rg.start = (rg.start + 1) % len(rg.buf)
+	} else {
+		rg.buf[(rg.start+rg.len)%len(rg.buf)] = r
+		rg.len++
+	}
+	rg.mu.Unlock()
+	rg.signal()
+}
+
+// pop removes the oldest item from the ring and returns it, ok being false if the ring is empty
+// and done true if it is also closed.
+func (rg *ring[R]) pop() (r R, ok, done bool) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if rg.len == 0 {
+		return r, false, rg.closed
+	}
+	var zero R
+	r, rg.buf[rg.start] = rg.buf[rg.start], zero
+	rg.start = (rg.start + 1) % len(rg.buf)
+	rg.len--
+	return r, true, false
+}
+
+// close records that no more items are pushed.
+func (rg *ring[R]) close() {
+	rg.mu.Lock()
+	rg.closed = true
+	rg.mu.Unlock()
+	rg.signal()
+}
+
+func (rg *ring[R]) signal() {
+	select {
+	case rg.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,76 @@
+package work_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work"
+	"github.com/pierrec/go-work/worktest"
+)
+
+func TestStream(t *testing.T) {
+	for _, n := range indexes {
+		next := 0
+		for r := range work.Stream(context.Background(), n, func(idx int) int { return idx * 2 }) {
+			if r != next*2 {
+				t.Errorf("unexpected result at position %d: %d", next, r)
+				t.FailNow()
+			}
+			next++
+		}
+		if next != n {
+			t.Errorf("unexpected number of results: got %d expected %d", next, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestStreamConsumerStops(t *testing.T) {
+	worktest.AssertNoLeak(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := work.Stream(ctx, 1000, func(idx int) int { return idx })
+		for i := 0; i < 3; i++ {
+			if r := <-out; r != i {
+				t.Errorf("unexpected result at position %d: %d", i, r)
+			}
+		}
+		// stop reading
+		cancel()
+	})
+}
+
+func TestStreamDropOldest(t *testing.T) {
+	const n, size = 100, 5
+	last := make(chan struct{})
+	out := work.Stream(context.Background(), n, func(idx int) int {
+		if idx == n-1 {
+			close(last)
+		}
+		return idx
+	}, work.WithDropOldest(size))
+	// the workers are not held back by the consumer
+	<-last
+	time.Sleep(10 * time.Millisecond)
+	var res []int
+	for r := range out {
+		if len(res) > 0 && r <= res[len(res)-1] {
+			t.Errorf("unexpected results order: %v", append(res, r))
+			t.FailNow()
+		}
+		res = append(res, r)
+	}
+	if len(res) == 0 || len(res) > size+1 || res[len(res)-1] != n-1 {
+		t.Errorf("expected the freshest results, got %v", res)
+		t.FailNow()
+	}
+}
+
+func TestStreamDropOldestConsumerStops(t *testing.T) {
+	worktest.AssertNoLeak(t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		out := work.Stream(ctx, 1000, func(idx int) int { return idx }, work.WithDropOldest(4))
+		<-out
+		cancel()
+	})
+}
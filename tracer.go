@@ -0,0 +1,56 @@
+package work
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Tracer starts the spans recorded by WithTracer.
+// It is small enough to be implemented by an adapter over a tracing library,
+// e.g. calling Start on an OpenTelemetry trace.Tracer.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	RecordError(err error)
+	End()
+}
+
+// traced returns a worker running worker within a span started by tracer.
+func traced(tracer Tracer, worker func(ctx context.Context, idx int) error) func(ctx context.Context, idx int) error {
+	return func(ctx context.Context, idx int) error {
+		ctx, span := tracer.Start(ctx, "worker "+strconv.Itoa(idx))
+		defer endSpan(span)
+		err := worker(ctx, idx)
+		if err != nil {
+			span.RecordError(err)
+		}
+		return err
+	}
+}
+
+// tracedFinalizer returns a finalizer running finalizer within a span started by tracer from ctx.
+func tracedFinalizer(ctx context.Context, tracer Tracer, finalizer func(idx int) error) func(idx int) error {
+	return func(idx int) error {
+		_, span := tracer.Start(ctx, "finalizer "+strconv.Itoa(idx))
+		defer endSpan(span)
+		err := finalizer(idx)
+		if err != nil {
+			span.RecordError(err)
+		}
+		return err
+	}
+}
+
+// endSpan ends span, recording the panic in progress if any before resuming it.
+func endSpan(span Span) {
+	if r := recover(); r != nil {
+		span.RecordError(fmt.Errorf("panic: %v", r))
+		span.End()
+		panic(r)
+	}
+	span.End()
+}
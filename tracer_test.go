@@ -0,0 +1,80 @@
+package work_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (tr *testTracer) Start(ctx context.Context, name string) (context.Context, work.Span) {
+	s := &testSpan{name: name}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, s)
+	tr.mu.Unlock()
+	return ctx, s
+}
+
+type testSpan struct {
+	name  string
+	err   error
+	ended bool
+}
+
+func (s *testSpan) RecordError(err error) { s.err = err }
+func (s *testSpan) End()                  { s.ended = true }
+
+// check returns the sorted names of the spans of tracer and their errors, checking that they were ended.
+func (tr *testTracer) check(t *testing.T) (names []string, errs map[string]string) {
+	errs = make(map[string]string)
+	for _, s := range tr.spans {
+		if !s.ended {
+			t.Errorf("span %q not ended", s.name)
+			t.FailNow()
+		}
+		names = append(names, s.name)
+		if s.err != nil {
+			errs[s.name] = s.err.Error()
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+func TestWithTracer(t *testing.T) {
+	tracer := &testTracer{}
+	err := work.DoWithError(3, func(int) error { return nil }, func(int) error { return nil }, work.WithTracer(tracer))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	names, errs := tracer.check(t)
+	if fmt.Sprint(names) != "[finalizer 0 finalizer 1 finalizer 2 worker 0 worker 1 worker 2]" || len(errs) != 0 {
+		t.Errorf("unexpected spans: %v %v", names, errs)
+		t.FailNow()
+	}
+
+	for _, tc := range []struct {
+		worker   func(int) error
+		expected string
+	}{
+		{func(int) error { return fmt.Errorf("fail") }, "fail"},
+		{func(int) error { panic("boom") }, "panic: boom"},
+	} {
+		tracer := &testTracer{}
+		_ = work.DoWithError(1, tc.worker, nil, work.WithTracer(tracer), work.WithPanicConverter(nil))
+		names, errs := tracer.check(t)
+		if fmt.Sprint(names) != "[worker 0]" || errs["worker 0"] != tc.expected {
+			t.Errorf("unexpected spans: %v %v", names, errs)
+			t.FailNow()
+		}
+	}
+}
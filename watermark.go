@@ -0,0 +1,26 @@
+package work
+
+import "context"
+
+// DoWithErrorWatermark spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to DoWithError but it also returns the highest index up to which all items were successfully
+// finalized, so that processing can be resumed after it without finalizing any item twice.
+// It is n-1 on success and -1 if no item was finalized.
+// With WithReverseFinalize, it is expressed in finalization order: items n-1 down to n-1-finalizedUpTo
+// were finalized.
+// finalizer must be set.
+func DoWithErrorWatermark(n int, worker, finalizer func(idx int) error, opts ...Option) (finalizedUpTo int, err error) {
+	return DoNWithErrorWatermark(n, worker, finalizer, numRoutines, opts...)
+}
+
+// DoNWithErrorWatermark spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoWithErrorWatermark.
+func DoNWithErrorWatermark(n int, worker, finalizer func(idx int) error, max int, opts ...Option) (finalizedUpTo int, err error) {
+	b := newBatch(context.Background(), n, withoutContext(worker), finalizer, max, opts)
+	b.run()
+	if b.watermark >= 0 {
+		// index maps positions to indexes and back
+		return b.index(b.watermark), b.err
+	}
+	return b.watermark, b.err
+}
@@ -0,0 +1,92 @@
+package work_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDoWithErrorWatermark(t *testing.T) {
+	for _, n := range indexes {
+		worker := func(idx int) error {
+			return nil
+		}
+		finalizer := func(idx int) error {
+			return nil
+		}
+		upTo, err := work.DoWithErrorWatermark(n, worker, finalizer)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			t.FailNow()
+		}
+		if upTo != n-1 {
+			t.Errorf("unexpected watermark: got %d expected %d", upTo, n-1)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithErrorWatermarkFinalizerError(t *testing.T) {
+	for _, n := range indexes {
+		if n < 1 {
+			continue
+		}
+		failAt := n / 2
+		worker := func(idx int) error {
+			return nil
+		}
+		var final []int
+		finalizer := func(idx int) error {
+			if idx == failAt {
+				return fmt.Errorf("fail")
+			}
+			final = append(final, idx)
+			return nil
+		}
+		upTo, err := work.DoWithErrorWatermark(n, worker, finalizer)
+		if err == nil {
+			t.Errorf("expected error")
+			t.FailNow()
+		}
+		if upTo != failAt-1 || len(final) != failAt {
+			t.Errorf("unexpected watermark: got %d expected %d (finalized %v)", upTo, failAt-1, final)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDoWithErrorWatermarkReverseFinalize(t *testing.T) {
+	const n, failAt = 10, 6
+	worker := func(idx int) error {
+		return nil
+	}
+	var final []int
+	finalizer := func(idx int) error {
+		if idx == failAt {
+			return fmt.Errorf("fail")
+		}
+		final = append(final, idx)
+		return nil
+	}
+	upTo, err := work.DoWithErrorWatermark(n, worker, finalizer, work.WithReverseFinalize())
+	if err == nil {
+		t.Errorf("expected error")
+		t.FailNow()
+	}
+	// items 9, 8 and 7 were finalized
+	if expected := n - 2 - failAt; upTo != expected || len(final) != expected+1 {
+		t.Errorf("unexpected watermark: got %d expected %d (finalized %v)", upTo, expected, final)
+		t.FailNow()
+	}
+
+	upTo, err = work.DoWithErrorWatermark(n, worker, func(int) error { return nil }, work.WithReverseFinalize())
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		t.FailNow()
+	}
+	if upTo != n-1 {
+		t.Errorf("unexpected watermark: got %d expected %d", upTo, n-1)
+		t.FailNow()
+	}
+}
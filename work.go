@@ -2,6 +2,7 @@
 package work
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -43,6 +44,15 @@ func do(n int, worker func(int), max int) {
 	wg.Wait()
 }
 
+// doYield is similar to do but yields the processor after each worker,
+// so that the goroutines running several workers in turn let unrelated goroutines run between them.
+func doYield(n int, worker func(int), max int) {
+	do(n, func(idx int) {
+		worker(idx)
+		runtime.Gosched()
+	}, max)
+}
+
 // doWithError spawns workers with index 0 to n-1, limiting their numbers by max.
 // Similar to do but with error handling.
 // The first error encountered aborts all processing and is then returned.
@@ -96,13 +106,20 @@ func doWithError(n int, worker func(int) error, max int) error {
 
 // Do spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
 // If finalizer is set, then it is called on the processed items, in increasing index order.
-func Do(n int, worker, finalizer func(idx int)) {
-	DoN(n, worker, finalizer, numRoutines)
+func Do(n int, worker, finalizer func(idx int), opts ...Option) {
+	DoN(n, worker, finalizer, numRoutines, opts...)
 }
 
 // DoN spawns workers with index 0 to n-1, limiting their numbers by max.
 // If finalizer is set, then it is called on the processed items, in increasing index order.
-func DoN(n int, worker, finalizer func(idx int), max int) {
+// A single item is finalized right after its worker returns.
+func DoN(n int, worker, finalizer func(idx int), max int, opts ...Option) {
+	if len(opts) > 0 {
+		b := newBatch(context.Background(), n, withoutError(worker), finalizerWithoutError(finalizer), max, opts)
+		b.run()
+		return
+	}
+
 	switch n {
 	case 0:
 		return
@@ -172,15 +189,23 @@ func DoN(n int, worker, finalizer func(idx int), max int) {
 // Similar to Do but with error handling.
 // The first error encountered aborts all processing and is then returned.
 // If finalizer is set, then it is called on the processed items, in increasing index order.
-func DoWithError(n int, worker, finalizer func(idx int) error) error {
-	return DoNWithError(n, worker, finalizer, numRoutines)
+func DoWithError(n int, worker, finalizer func(idx int) error, opts ...Option) error {
+	return DoNWithError(n, worker, finalizer, numRoutines, opts...)
 }
 
 // DoNWithError spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
 // Similar to DoN but with error handling.
 // The first error encountered aborts all processing and is then returned.
 // If finalizer is set, then it is called on the processed items, in increasing index order.
-func DoNWithError(n int, worker, finalizer func(idx int) error, max int) error {
+// As with any other item, a single item is only finalized if its worker succeeded,
+// unless WithAlwaysFinalize is used.
+func DoNWithError(n int, worker, finalizer func(idx int) error, max int, opts ...Option) error {
+	if len(opts) > 0 {
+		b := newBatch(context.Background(), n, withoutContext(worker), finalizer, max, opts)
+		b.run()
+		return b.err
+	}
+
 	switch n {
 	case 0:
 		return nil
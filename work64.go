@@ -0,0 +1,101 @@
+package work
+
+import "sync"
+
+// do64 is the int64 version of do.
+func do64(n int64, worker func(int64), max int) {
+	var wg sync.WaitGroup
+	if n <= int64(max) {
+		// spawn as many goroutines as number of workers
+		wg.Add(int(n))
+		for i := int64(0); i < n; i++ {
+			go func(idx int64) {
+				worker(idx)
+				wg.Done()
+			}(i)
+		}
+		wg.Wait()
+		return
+	}
+
+	// spawn the maximum number of goroutines
+	wg.Add(max)
+	for i := 0; i < max; i++ {
+		go func(idx int64) {
+			for ; idx < n; idx += int64(max) {
+				worker(idx)
+			}
+			wg.Done()
+		}(int64(i))
+	}
+	wg.Wait()
+}
+
+// Do64 spawns workers with index 0 to n-1, limiting their numbers by GOMAXPROCS.
+// Similar to Do but with int64 indexes, for sequences that do not fit in an int on 32 bits platforms.
+func Do64(n int64, worker, finalizer func(idx int64)) {
+	DoN64(n, worker, finalizer, numRoutines)
+}
+
+// DoN64 spawns workers with index 0 to n-1, limiting their numbers by max.
+// Similar to DoN but with int64 indexes, for sequences that do not fit in an int on 32 bits platforms.
+func DoN64(n int64, worker, finalizer func(idx int64), max int) {
+	switch n {
+	case 0:
+		return
+	case 1:
+		worker(0)
+		if finalizer != nil {
+			finalizer(0)
+		}
+		return
+	}
+
+	if finalizer == nil {
+		do64(n, worker, max)
+		return
+	}
+
+	var (
+		donec   = make(chan struct{}, max) // worker throttling
+		workc   = make(chan int64)         // results from workers
+		wg, wgf sync.WaitGroup
+	)
+
+	// initialize the go routine managing the results and
+	// dispatching to the finalizer in order
+	wgf.Add(1)
+	go func() {
+		defer wgf.Done()
+		// buffer holds results that cannot be finalized yet.
+		buffer := make(map[int64]struct{})
+		var pos int64
+		for idx := range workc {
+			buffer[idx] = struct{}{}
+			for ; ; pos++ {
+				if _, ok := buffer[pos]; !ok {
+					break
+				}
+				delete(buffer, pos)
+				finalizer(pos)
+			}
+		}
+	}()
+
+	// process all items in the list, with a concurrency of max
+	for i := int64(0); i < n; i++ {
+		wg.Add(1)
+		go func(idx int64) {
+			worker(idx)
+			workc <- idx
+			<-donec
+			wg.Done()
+		}(i)
+		// throttling
+		donec <- struct{}{}
+	}
+
+	wg.Wait()
+	close(workc)
+	wgf.Wait()
+}
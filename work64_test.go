@@ -0,0 +1,45 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestDo64(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int64) {
+			results[idx] = 1
+		}
+		work.Do64(int64(n), worker, nil)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+	}
+}
+
+func TestDo64Finalizer(t *testing.T) {
+	for _, n := range indexes {
+		results := make([]int, n)
+		worker := func(idx int64) {
+			results[idx] = 1
+		}
+		var final []int64
+		finalizer := func(idx int64) {
+			final = append(final, idx)
+		}
+		work.DoN64(int64(n), worker, finalizer, 2)
+		if m := count(results); m != n {
+			t.Errorf("unexpected results size: got %d expected %d", m, n)
+			t.FailNow()
+		}
+		for i := 0; i < n; i++ {
+			if final[i] != int64(i) {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package worktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pierrec/go-work"
+)
+
+// FakeClock is a work.Clock whose time only moves forward with Advance,
+// making the timing of calls using it with work.WithClock deterministic.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{} // closed when timers are added
+}
+
+var _ work.Clock = (*FakeClock)(nil)
+
+// NewFakeClock returns a FakeClock set at now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the time of the clock once it advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer firing once the clock advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) work.Timer {
+	return c.add(d, make(chan time.Time, 1), nil)
+}
+
+// AfterFunc returns a Timer calling f in its own goroutine once the clock advanced by d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) work.Timer {
+	return c.add(d, nil, f)
+}
+
+func (c *FakeClock) add(d time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, when: c.now.Add(d), ch: ch, f: f}
+	if d <= 0 {
+		t.fire(c.now)
+		return t
+	}
+	c.timers = append(c.timers, t)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return t
+}
+
+// Advance moves the time of the clock forward by d, firing the timers due by then in time order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+	i := 0
+	for ; i < len(c.timers) && !c.timers[i].when.After(c.now); i++ {
+		c.timers[i].fire(c.now)
+	}
+	c.timers = c.timers[i:]
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitTimers blocks until at least n timers are waiting to fire,
+// e.g. to make sure the code under test is waiting on the clock before calling Advance.
+func (c *FakeClock) WaitTimers(n int) {
+	for {
+		c.mu.Lock()
+		m, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if m >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// fakeTimer is a work.Timer of a FakeClock.
+type fakeTimer struct {
+	c     *FakeClock
+	when  time.Time
+	ch    chan time.Time
+	f     func()
+	fired bool
+}
+
+// fire sends now on the channel of the timer or calls its function.
+// The clock lock must be held.
+func (t *fakeTimer) fire(now time.Time) {
+	t.fired = true
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	t.ch <- now
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if t.fired {
+		return false
+	}
+	for i, x := range t.c.timers {
+		if x == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			break
+		}
+	}
+	t.fired = true
+	return true
+}
@@ -0,0 +1,48 @@
+package worktest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pierrec/go-work/worktest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := worktest.NewFakeClock(start)
+	t1 := c.NewTimer(time.Second)
+	t2 := c.NewTimer(2 * time.Second)
+	called := make(chan struct{})
+	c.AfterFunc(time.Second, func() { close(called) })
+
+	c.Advance(time.Second)
+	if got := c.Now(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("unexpected time: got %v", got)
+		t.FailNow()
+	}
+	select {
+	case <-t1.C():
+	default:
+		t.Errorf("expected the first timer to fire")
+		t.FailNow()
+	}
+	<-called
+	select {
+	case <-t2.C():
+		t.Errorf("unexpected second timer firing")
+		t.FailNow()
+	default:
+	}
+	if !t2.Stop() {
+		t.Errorf("expected the second timer to be stopped")
+		t.FailNow()
+	}
+	if t1.Stop() {
+		t.Errorf("unexpected stop of a fired timer")
+		t.FailNow()
+	}
+	if m := c.Timers(); m != 0 {
+		t.Errorf("unexpected pending timers: %d", m)
+		t.FailNow()
+	}
+}
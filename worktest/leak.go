@@ -0,0 +1,87 @@
+// Package worktest provides helpers to test code using the work package.
+package worktest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// settleTimeout is how long AssertNoLeak waits for goroutines to exit.
+const settleTimeout = time.Second
+
+// AssertNoLeak runs fn and fails t if goroutines started while it ran are still running once it returns.
+// Goroutines are identified by their id, so that the ones running before fn and exiting during
+// or after it are not mistaken for goroutines that fn did not leak.
+// Since goroutines may take some time to exit after fn returns, the check is repeated,
+// with an increasing delay, for up to one second before failing.
+func AssertNoLeak(t testing.TB, fn func()) {
+	t.Helper()
+	before := settle(goroutines())
+	fn()
+
+	leaked := newGoroutines(before)
+	deadline := time.Now().Add(settleTimeout)
+	for delay := time.Millisecond; len(leaked) > 0 && time.Now().Before(deadline); delay *= 2 {
+		runtime.Gosched()
+		time.Sleep(delay)
+		leaked = newGoroutines(before)
+	}
+	if len(leaked) > 0 {
+		t.Errorf("worktest: %d goroutines leaked:\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// settle gives the goroutines exiting when AssertNoLeak is called the chance to do so,
+// until the set of goroutines stops shrinking or the timeout expires.
+func settle(gs map[string]string) map[string]string {
+	deadline := time.Now().Add(settleTimeout)
+	for time.Now().Before(deadline) {
+		runtime.Gosched()
+		time.Sleep(time.Millisecond)
+		next := goroutines()
+		if len(next) >= len(gs) {
+			return gs
+		}
+		gs = next
+	}
+	return gs
+}
+
+// newGoroutines returns the stacks of the goroutines that are not in before.
+func newGoroutines(before map[string]string) []string {
+	var leaked []string
+	for id, stack := range goroutines() {
+		if _, ok := before[id]; !ok {
+			leaked = append(leaked, stack)
+		}
+	}
+	return leaked
+}
+
+// goroutines returns the stacks of all the goroutines indexed by their id,
+// except the one of the caller.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	gs := make(map[string]string)
+	// the first stack is the one of the current goroutine
+	for _, stack := range bytes.Split(buf, []byte("\n\n"))[1:] {
+		// each stack starts with: goroutine <id> [<status>]:
+		fields := bytes.Fields(stack)
+		if len(fields) < 2 {
+			continue
+		}
+		gs[string(fields[1])] = string(stack)
+	}
+	return gs
+}
@@ -0,0 +1,51 @@
+package worktest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pierrec/go-work"
+	"github.com/pierrec/go-work/worktest"
+)
+
+func TestAssertNoLeak(t *testing.T) {
+	worktest.AssertNoLeak(t, func() {
+		work.Do(100, func(int) {}, func(int) {})
+	})
+	worktest.AssertNoLeak(t, func() {
+		_ = work.DoNWithContext(context.Background(), 100, func(ctx context.Context, idx int) error {
+			if idx == 10 {
+				return fmt.Errorf("fail")
+			}
+			return nil
+		}, func(int) error { return nil }, 4)
+	})
+}
+
+// recorder records the failures of a test.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+}
+
+func TestAssertNoLeakFails(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	r := &recorder{TB: t}
+	worktest.AssertNoLeak(r, func() {
+		go func() {
+			<-stop
+		}()
+	})
+	if !r.failed {
+		t.Errorf("leaked goroutine not detected")
+		t.FailNow()
+	}
+}
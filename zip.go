@@ -0,0 +1,20 @@
+package work
+
+// Zip spawns workers for each index i of the a and b slices, limiting their numbers by GOMAXPROCS.
+// The worker for index i receives the elements a[i] and b[i].
+// If finalizer is set, then it is called on the processed items, in increasing index order.
+// Zip panics if a and b do not have the same length.
+func Zip[A, B any](a []A, b []B, worker, finalizer func(i int, x A, y B)) {
+	if len(a) != len(b) {
+		panic("work: Zip on slices of different lengths")
+	}
+	var final func(idx int)
+	if finalizer != nil {
+		final = func(idx int) {
+			finalizer(idx, a[idx], b[idx])
+		}
+	}
+	Do(len(a), func(idx int) {
+		worker(idx, a[idx], b[idx])
+	}, final)
+}
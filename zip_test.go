@@ -0,0 +1,49 @@
+package work_test
+
+import (
+	"testing"
+
+	"github.com/pierrec/go-work"
+)
+
+func TestZip(t *testing.T) {
+	for _, n := range indexes {
+		a := make([]int, n)
+		b := make([]string, n)
+		for i := range a {
+			a[i] = i
+			b[i] = string(rune('a' + i%26))
+		}
+		results := make([]string, n)
+		worker := func(i int, x int, y string) {
+			if x != i || y != b[i] {
+				t.Errorf("unexpected elements for index %d: %d %q", i, x, y)
+			}
+			results[i] = y
+		}
+		var final []int
+		finalizer := func(i int, x int, y string) {
+			final = append(final, x)
+		}
+		work.Zip(a, b, worker, finalizer)
+		for i := 0; i < n; i++ {
+			if results[i] != b[i] {
+				t.Errorf("missing index %d", i)
+				t.FailNow()
+			}
+			if final[i] != i {
+				t.Errorf("finalizer ran out of order: %v", final)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+func TestZipLengthMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic on slices of different lengths")
+		}
+	}()
+	work.Zip([]int{1, 2}, []int{1}, func(int, int, int) {}, nil)
+}